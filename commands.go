@@ -0,0 +1,158 @@
+// Copyright (C) 2021 SeanTolstoyevski - mailto:seantolstoyevski@protonmail.com
+//
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	paket "github.com/SeanTolstoyevski/paket/pengine"
+)
+
+// command is a subcommand of the cmd tool, like "paket extract".
+// Without a subcommand, the tool creates a paket from a folder.
+type command struct {
+	// one line description for the usage text.
+	usage string
+
+	// run gets the arguments after the command name.
+	run func(args []string)
+}
+
+var commands = map[string]command{
+	"add":     {"add new files to a paket", runAdd},
+	"compact": {"rewrite a paket without the data of the removed and replaced files", runCompact},
+	"extract": {"decrypt the entries of a paket and write them to a folder", runExtract},
+	"keygen":  {"create a key pair for the recipients or for signing a paket", runKeygen},
+	"list":    {"print the entries of a paket with their sizes, positions and hashes", runList},
+	"replace": {"write the new data of files that are in a paket", runReplace},
+	"rekey":   {"encrypt a paket again with a new key or KDF", runRekey},
+	"rm":      {"remove files from a paket", runRm},
+	"sign":    {"sign the manifest of a paket with an Ed25519 key", runSign},
+	"slot":    {"list, add or remove the key slots of a paket created with -envelope", runSlot},
+	"verify":  {"check the positions and the hashes of the entries of a paket", runVerify},
+}
+
+// runCommand runs the subcommand with its arguments.
+func runCommand(name string, args []string) {
+	cmd, found := commands[name]
+	if !found {
+		fmt.Printf("%s is not a paket command.\n\nCommands:\n", name)
+		printCommands()
+		os.Exit(2)
+	}
+	cmd.run(args)
+}
+
+// printCommands prints the commands and their descriptions.
+func printCommands() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %-10s %s\n", name, commands[name].usage)
+	}
+	fmt.Printf("\nSee %s <command> -help for the flags of a command.\n", os.Args[0])
+}
+
+// openFlags are the flags needed to open an existing paket. They are shared by the commands.
+type openFlags struct {
+	pack         *string
+	key          *string
+	table        *string
+	mode         *string
+	iteration    *uint
+	iterTemplate *string
+	keyHex       *bool
+	keySlot      *string
+	identity     *string
+	trusted      *string
+}
+
+// addOpenFlags defines the flags for opening a paket on fs.
+func addOpenFlags(fs *flag.FlagSet) *openFlags {
+	return &openFlags{
+		pack:         fs.String("p", "data.pack", "The paket file to read."),
+		key:          fs.String("k", "", "Key of the paket."),
+		table:        fs.String("t", "", "The Go table (PaketTable.go) of a paket created with -legacy.\nIf it is empty, the paket is read as a container file and its own index is used."),
+		mode:         fs.String("m", "gcm", "Encryption mode of a legacy paket. Only used with -t."),
+		iteration:    fs.Uint("i", 4096, "PBKDF2 iteration of a legacy paket. Only used with -t, for the old tables without PaketKDF."),
+		iterTemplate: fs.String("itertemplate", "", "JSON template of the key derivation pipeline, if the paket was created with one."),
+		keyHex:       fs.Bool("khex", false, "-k is hex encoded, like the raw 32 byte key of a key slot with the ''raw'' KDF."),
+		keySlot:      fs.String("keyslot", "", "Name of the key slot to open, for a paket created with -envelope. By default all slots are tried."),
+		trusted:      fs.String("trusted", "", "Ed25519 public key (a .pub file of ''keygen -type ed25519'', or hex). The paket is opened only if its manifest is signed by this key."),
+		identity:     fs.String("identity", "", "X25519 private key (a .key file of keygen, or hex) of a recipient of the paket. -k is not needed with it."),
+	}
+}
+
+// open opens the paket with the flags.
+func (o *openFlags) open() (*paket.Paket, error) {
+	opt, err := o.option()
+	if err != nil {
+		return nil, err
+	}
+	return paket.New(opt)
+}
+
+// option returns the Option for the flags. For a legacy paket, the Go table is loaded.
+func (o *openFlags) option() (paket.Option, error) {
+	key, err := parseKey(*o.key, *o.keyHex)
+	if err != nil {
+		return paket.Option{}, err
+	}
+	opt := paket.Option{Key: key, PaketFile: *o.pack, KeySlot: *o.keySlot}
+	if *o.identity != "" {
+		opt.Identity, err = readHexKey(*o.identity)
+		if err != nil {
+			return opt, err
+		}
+	}
+	if *o.trusted != "" {
+		opt.TrustedKey, err = readHexKey(*o.trusted)
+		if err != nil {
+			return opt, err
+		}
+	}
+	if *o.iterTemplate != "" {
+		pipeline, err := paket.LoadKeyDerivationPipeline(*o.iterTemplate)
+		if err != nil {
+			return opt, err
+		}
+		opt.Pipeline = pipeline
+	}
+	if *o.table != "" {
+		if err := loadGoTable(*o.table, &opt); err != nil {
+			return opt, err
+		}
+		opt.Mode, err = parseMode(*o.mode)
+		if err != nil {
+			return opt, err
+		}
+		// old tables do not have PaketKDF.
+		if opt.KDF.Algorithm == 0 {
+			opt.KDF = paket.KDF{Algorithm: paket.KDFPBKDF2, Iteration: *o.iteration}
+		}
+	}
+	return opt, nil
+}
+
+// parseKey returns the key of a flag. If isHex is true, the key is hex encoded.
+func parseKey(key string, isHex bool) ([]byte, error) {
+	if !isHex {
+		return []byte(key), nil
+	}
+	decoded, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("hex key: %v", err)
+	}
+	return decoded, nil
+}
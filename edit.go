@@ -0,0 +1,229 @@
+// Copyright (C) 2021 SeanTolstoyevski - mailto:seantolstoyevski@protonmail.com
+//
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	paket "github.com/SeanTolstoyevski/paket/pengine"
+)
+
+// inputFile is a file given to add or replace, with its name in the paket.
+type inputFile struct {
+	path string
+	name string
+}
+
+// runAdd adds new files to an existing paket.
+//
+//	paket add -p data.pack -k my_secret_key -n textures/new.png new.png
+func runAdd(args []string) {
+	runWrite("add", args, (*paket.Editor).Add)
+}
+
+// runReplace writes the new data of files that are already in the paket.
+//
+//	paket replace -p data.pack -k my_secret_key -n textures/ui/button.png button.png
+func runReplace(args []string) {
+	runWrite("replace", args, (*paket.Editor).Replace)
+}
+
+// runWrite is add and replace. write is the Editor method that is called for each file.
+func runWrite(name string, args []string, write func(*paket.Editor, string, []byte) (paket.Values, error)) {
+	flagSet := flag.NewFlagSet(name, flag.ExitOnError)
+	of := addOpenFlags(flagSet)
+	entryName := flagSet.String("n", "", "Name of the file in the paket, like ''textures/ui/button.png''. Only for one file.\nBy default it is the name of the file. Files in a folder are named with their paths relative to the folder.")
+	compressName := flagSet.String("c", "none", "Compression of the files: ''none'', ''deflate'' or ''zstd''.")
+	showProgress := flagSet.Bool("s", true, "prints progress steps to the console.")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s %s [flags] file or folder...\n", os.Args[0], name)
+		flagSet.PrintDefaults()
+	}
+	flagSet.Parse(args)
+
+	compression, err := parseCompression(*compressName)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	files, err := inputFiles(flagSet.Args(), *entryName)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+
+	editPaket(of, paket.EditorOption{Compression: compression}, func(e *paket.Editor) error {
+		for _, file := range files {
+			if *showProgress {
+				fmt.Printf("%s: %s\n", name, file.name)
+			}
+			content, err := ioutil.ReadFile(file.path)
+			if err != nil {
+				return err
+			}
+			if _, err := write(e, file.name, content); err != nil {
+				return fmt.Errorf("%s: %v", file.name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// runRm removes files from a paket. Their data stays in the file until compact.
+//
+//	paket rm -p data.pack -k my_secret_key textures/old.png
+func runRm(args []string) {
+	flagSet := flag.NewFlagSet("rm", flag.ExitOnError)
+	of := addOpenFlags(flagSet)
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s rm [flags] name...\n", os.Args[0])
+		flagSet.PrintDefaults()
+	}
+	flagSet.Parse(args)
+	if flagSet.NArg() == 0 {
+		flagSet.Usage()
+		os.Exit(2)
+	}
+
+	editPaket(of, paket.EditorOption{}, func(e *paket.Editor) error {
+		for _, name := range flagSet.Args() {
+			if err := e.Remove(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// runCompact rewrites a paket without the data of the removed and replaced files.
+//
+//	paket compact -p data.pack -k my_secret_key
+func runCompact(args []string) {
+	flagSet := flag.NewFlagSet("compact", flag.ExitOnError)
+	of := addOpenFlags(flagSet)
+	flagSet.Parse(args)
+
+	opt, err := of.option()
+	if err != nil {
+		fmt.Println("Error: opening the paket:", err)
+		os.Exit(1)
+	}
+	before, err := os.Stat(opt.PaketFile)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	table, err := paket.Compact(opt)
+	if err != nil {
+		fmt.Println("Error: compacting the paket:", err)
+		os.Exit(1)
+	}
+	if opt.Table != nil {
+		// the positions change, the signature is not valid anymore.
+		opt.Table, opt.Signature = table, nil
+		if err := writeGoTable(*of.table, opt); err != nil {
+			fmt.Println("Error: writing the table:", err)
+			os.Exit(1)
+		}
+	}
+
+	after, err := os.Stat(opt.PaketFile)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: %d bytes -> %d bytes\n", opt.PaketFile, before.Size(), after.Size())
+}
+
+// editPaket opens the paket with an Editor, runs edit and saves the changes.
+// For a legacy paket the Go table is written again.
+// Exits if there is an error.
+func editPaket(of *openFlags, eo paket.EditorOption, edit func(e *paket.Editor) error) {
+	opt, err := of.option()
+	if err != nil {
+		fmt.Println("Error: opening the paket:", err)
+		os.Exit(1)
+	}
+	e, err := paket.OpenEditor(opt, eo)
+	if err != nil {
+		fmt.Println("Error: opening the paket:", err)
+		os.Exit(1)
+	}
+
+	// the signature of a changed paket is not valid anymore, it must be signed again.
+	saved := opt
+	saved.Signature = nil
+	if err := edit(e); err != nil {
+		fmt.Println("Error:", err)
+		// the entries written before the error are saved, the file must stay readable.
+		if err := e.Close(); err != nil {
+			fmt.Println("Error: saving the paket:", err)
+		}
+		// the data of a legacy paket is already written, only the new table can open it.
+		if opt.Table != nil {
+			saved.Table = e.Table()
+			if err := writeGoTable(*of.table, saved); err != nil {
+				fmt.Println("Error: writing the table, the new entries cannot be opened:", err)
+			}
+		}
+		os.Exit(1)
+	}
+	if err := e.Close(); err != nil {
+		fmt.Println("Error: saving the paket:", err)
+		os.Exit(1)
+	}
+	if opt.Table != nil {
+		saved.Table = e.Table()
+		if err := writeGoTable(*of.table, saved); err != nil {
+			fmt.Println("Error: writing the table:", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// inputFiles returns the files for the arguments of add and replace.
+// Folders are walked like the folder of the tool, their files are named relative to the folder.
+func inputFiles(args []string, name string) ([]inputFile, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no file is given")
+	}
+	if name != "" && len(args) > 1 {
+		return nil, fmt.Errorf("-n can only be used with one file")
+	}
+
+	var files []inputFile
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			if name == "" {
+				files = append(files, inputFile{path: arg, name: filepath.Base(arg)})
+			} else {
+				files = append(files, inputFile{path: arg, name: name})
+			}
+			continue
+		}
+		if name != "" {
+			return nil, fmt.Errorf("-n cannot be used with a folder")
+		}
+		found, err := collectFiles(arg, false, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range found {
+			files = append(files, inputFile{path: f.path, name: f.name})
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,183 @@
+// Copyright (C) 2021 SeanTolstoyevski - mailto:seantolstoyevski@protonmail.com
+//
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	paket "github.com/SeanTolstoyevski/paket/pengine"
+)
+
+// runExtract decrypts the entries of a paket and recreates the folder tree.
+//
+//	paket extract -p data.pack -k my_secret_key -o out -g "textures/*"
+func runExtract(args []string) {
+	flagSet := flag.NewFlagSet("extract", flag.ExitOnError)
+	of := addOpenFlags(flagSet)
+	outDir := flagSet.String("o", "extracted", "The folder to write the files to. It is created if it does not exist.")
+	pattern := flagSet.String("g", "", "Only extract the entries matching this glob pattern (like ''textures/*.png'', see path.Match).\nWith -anon the pattern is matched against the restored names.")
+	anonFile := flagSet.String("anon", "", "anonymization-information.txt written by the -a flag. The anonymized names are restored with it.")
+	overwrite := flagSet.Bool("overwrite", false, "overwrite the existing files in the output folder.")
+	showProgress := flagSet.Bool("s", true, "prints progress steps to the console.")
+	flagSet.Parse(args)
+
+	if *pattern != "" {
+		if _, err := path.Match(*pattern, ""); err != nil {
+			fmt.Println("Error: invalid pattern:", err)
+			os.Exit(2)
+		}
+	}
+
+	var names map[string]string
+	if *anonFile != "" {
+		var err error
+		names, err = loadAnonymization(*anonFile)
+		if err != nil {
+			fmt.Println("Error: reading the anonymization information:", err)
+			os.Exit(1)
+		}
+	}
+
+	p, err := of.open()
+	if err != nil {
+		fmt.Println("Error: opening the paket:", err)
+		os.Exit(1)
+	}
+	defer p.Close()
+
+	count, failed := 0, 0
+	for _, name := range p.Names() {
+		outName := name
+		if original, found := names[name]; found {
+			outName = original
+		}
+		if *pattern != "" {
+			if matched, _ := path.Match(*pattern, outName); !matched {
+				continue
+			}
+		}
+
+		if *showProgress {
+			fmt.Println(outName)
+		}
+		if err := extractEntry(p, name, outName, *outDir, *overwrite); err != nil {
+			fmt.Printf("Error: %s: %v\n", outName, err)
+			failed++
+			continue
+		}
+		count++
+	}
+
+	if *showProgress {
+		fmt.Printf("%d files were extracted to %s.\n", count, *outDir)
+	}
+	if failed > 0 {
+		fmt.Printf("%d files could not be extracted.\n", failed)
+		// deferred Close is skipped by os.Exit.
+		p.Close()
+		os.Exit(1)
+	}
+}
+
+// extractEntry decrypts the entry name and writes it to outName in dir.
+// The hash of the decrypted data is checked while writing, the file is removed if it does not match.
+func extractEntry(p *paket.Paket, name, outName, dir string, overwrite bool) error {
+	dst, err := outputPath(dir, outName)
+	if err != nil {
+		return err
+	}
+	v, _ := p.Entry(name)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overwrite {
+		flags |= os.O_EXCL
+	}
+	out, err := os.OpenFile(dst, flags, 0644)
+	if err != nil {
+		return err
+	}
+
+	in, err := p.OpenFile(name)
+	if err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	defer in.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, h), in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && !bytes.Equal(h.Sum(nil), v.HashOriginal) {
+		err = paket.ErrHashMismatch
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+// outputPath returns the path of the file outName in dir.
+// The names come from the paket or the anonymization file. "../", absolute names,
+// and the backslashes and drive letters of Windows ("..\evil.exe", "C:x") must not write outside of the folder.
+func outputPath(dir, outName string) (string, error) {
+	if !fs.ValidPath(outName) || strings.ContainsAny(outName, `\:`) {
+		return "", fmt.Errorf("invalid file name in paket: %q", outName)
+	}
+	dst := filepath.Join(dir, filepath.FromSlash(outName))
+	if rel, err := filepath.Rel(dir, dst); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid file name in paket: %q", outName)
+	}
+	return dst, nil
+}
+
+// loadAnonymization reads the anonymization information file written by the -a flag.
+// It returns the original names by the anonymous names.
+func loadAnonymization(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	names := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	first := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		if first {
+			// "original   \t   anonymous" header
+			first = false
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		pair := strings.Split(line, "\t")
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid line: %q", line)
+		}
+		names[strings.TrimSpace(pair[1])] = strings.TrimSpace(pair[0])
+	}
+	return names, scanner.Err()
+}
@@ -0,0 +1,113 @@
+// Copyright (C) 2021 SeanTolstoyevski - mailto:seantolstoyevski@protonmail.com
+//
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	paket "github.com/SeanTolstoyevski/paket/pengine"
+)
+
+func TestOutputPath(t *testing.T) {
+	dir := filepath.Join("out", "dir")
+	valid := map[string]string{
+		"readme.txt":        filepath.Join(dir, "readme.txt"),
+		"ui/img/logo.png":   filepath.Join(dir, "ui", "img", "logo.png"),
+		"..name/with..dots": filepath.Join(dir, "..name", "with..dots"),
+	}
+	for name, want := range valid {
+		got, err := outputPath(dir, name)
+		if err != nil || got != want {
+			t.Errorf("%q: %q, %v; want %q", name, got, err, want)
+		}
+	}
+
+	for _, name := range []string{"", ".", "..", "../evil.exe", "ui/../../evil.exe", "/etc/passwd", "ui//a", `..\evil.exe`, `ui\..\..\evil.exe`, "C:x", `C:\Windows\evil.exe`, "ui/c:evil"} {
+		if got, err := outputPath(dir, name); err == nil {
+			t.Errorf("%q is accepted: %q", name, got)
+		}
+	}
+}
+
+func TestExtractEntry(t *testing.T) {
+	files := map[string]string{"a.txt": "alpha", "b.txt": "bravo", "c.txt": ""}
+	o := writeLegacyTestPaket(t, files)
+	p, err := paket.New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	dir := t.TempDir()
+	for name, want := range files {
+		if err := extractEntry(p, name, "out/"+name, dir, false); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := os.ReadFile(filepath.Join(dir, "out", name))
+		if err != nil || string(got) != want {
+			t.Fatalf("%s: %q, %v", name, got, err)
+		}
+	}
+	if err := extractEntry(p, "a.txt", "out/a.txt", dir, false); err == nil {
+		t.Error("an existing file is overwritten without overwrite")
+	}
+	if err := extractEntry(p, "b.txt", "out/a.txt", dir, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "out", "a.txt")); string(got) != "bravo" {
+		t.Errorf("overwritten file: %q", got)
+	}
+	if err := extractEntry(p, "a.txt", "../a.txt", dir, true); err == nil {
+		t.Error("a file is written outside of the folder")
+	}
+}
+
+// the file is removed when the decrypted data does not match the hash in the table.
+func TestExtractEntryHashMismatch(t *testing.T) {
+	o := writeLegacyTestPaket(t, map[string]string{"a.txt": "alpha", "b.txt": "bravo", "c.txt": "charlie"})
+	v := o.Table["b.txt"]
+	v.HashOriginal = o.Table["a.txt"].HashOriginal
+	o.Table["b.txt"] = v
+	p, err := paket.New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	dir := t.TempDir()
+	if err := extractEntry(p, "b.txt", "b.txt", dir, false); !errors.Is(err, paket.ErrHashMismatch) {
+		t.Fatalf("extractEntry: %v, want ErrHashMismatch", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("the file is not removed: %v", err)
+	}
+}
+
+func TestLoadAnonymization(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "anonymization-information.txt")
+	data := "original   \t   anonymous\r\n\r\nui/index.html   \t   a1b2c3\r\nreadme.txt   \t   d4e5f6\r\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	names, err := loadAnonymization(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names["a1b2c3"] != "ui/index.html" || names["d4e5f6"] != "readme.txt" {
+		t.Errorf("names: %v", names)
+	}
+
+	if err := os.WriteFile(path, []byte(data+"no tab\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadAnonymization(path); err == nil {
+		t.Error("a line without a tab is accepted")
+	}
+}
@@ -1,5 +1,8 @@
 module github.com/SeanTolstoyevski/paket
 
-go 1.15
+go 1.16
 
-require golang.org/x/crypto v0.0.0-20210513164829-c07d793c2f9a
+require (
+	github.com/klauspost/compress v1.13.6
+	golang.org/x/crypto v0.0.0-20210513164829-c07d793c2f9a
+)
@@ -0,0 +1,271 @@
+// Copyright (C) 2021 SeanTolstoyevski - mailto:seantolstoyevski@protonmail.com
+//
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	paket "github.com/SeanTolstoyevski/paket/pengine"
+)
+
+// loadGoTable reads a Go table written by the tool with -legacy, without compiling it.
+// PaketData, PaketSalt, PaketID, PaketEntryKeys, PaketKDF and PaketSignature are set to
+// opt.Table, opt.Salt, opt.ID, opt.EntryKeys, opt.KDF and opt.Signature.
+// The KDF, the ID and EntryKeys are the zero value for the old tables that do not have them.
+//
+// Only the literals written by the tool are understood (strings, integers, booleans, []byte{...}, nil and struct literals).
+func loadGoTable(path string, opt *paket.Option) error {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		return err
+	}
+	opt.Table = nil
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs, ok := spec.(*ast.ValueSpec)
+			if !ok || len(vs.Names) != 1 || len(vs.Values) != 1 {
+				continue
+			}
+			var target interface{}
+			switch vs.Names[0].Name {
+			case "PaketData":
+				target = &opt.Table
+			case "PaketSalt":
+				target = &opt.Salt
+			case "PaketID":
+				target = &opt.ID
+			case "PaketEntryKeys":
+				target = &opt.EntryKeys
+			case "PaketKDF":
+				target = &opt.KDF
+			case "PaketSignature":
+				target = &opt.Signature
+			default:
+				continue
+			}
+			if err := setLiteral(reflect.ValueOf(target).Elem(), vs.Values[0]); err != nil {
+				return fmt.Errorf("%s: %s: %v", path, vs.Names[0].Name, err)
+			}
+		}
+	}
+	if opt.Table == nil {
+		return errors.New(path + ": PaketData not found")
+	}
+	return nil
+}
+
+// setLiteral sets v to the value of the literal expression e.
+func setLiteral(v reflect.Value, e ast.Expr) error {
+	if id, ok := e.(*ast.Ident); ok && id.Name == "nil" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		id, ok := e.(*ast.Ident)
+		if !ok || (id.Name != "true" && id.Name != "false") {
+			return errors.New("boolean expected")
+		}
+		v.SetBool(id.Name == "true")
+
+	case reflect.String:
+		lit, ok := e.(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return errors.New("string expected")
+		}
+		s, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint32, reflect.Uint64:
+		lit, ok := e.(*ast.BasicLit)
+		if !ok || lit.Kind != token.INT {
+			return errors.New("integer expected")
+		}
+		if v.Kind() == reflect.Int || v.Kind() == reflect.Int64 {
+			n, err := strconv.ParseInt(lit.Value, 0, v.Type().Bits())
+			if err != nil {
+				return err
+			}
+			v.SetInt(n)
+		} else {
+			n, err := strconv.ParseUint(lit.Value, 0, v.Type().Bits())
+			if err != nil {
+				return err
+			}
+			v.SetUint(n)
+		}
+
+	case reflect.Slice:
+		comp, ok := e.(*ast.CompositeLit)
+		if !ok {
+			return errors.New("slice literal expected")
+		}
+		s := reflect.MakeSlice(v.Type(), len(comp.Elts), len(comp.Elts))
+		for i, elt := range comp.Elts {
+			if err := setLiteral(s.Index(i), elt); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+
+	case reflect.Map:
+		comp, ok := e.(*ast.CompositeLit)
+		if !ok {
+			return errors.New("map literal expected")
+		}
+		m := reflect.MakeMapWithSize(v.Type(), len(comp.Elts))
+		for _, elt := range comp.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				return errors.New("key: value expected")
+			}
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := setLiteral(key, kv.Key); err != nil {
+				return err
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := setLiteral(value, kv.Value); err != nil {
+				return fmt.Errorf("%v: %v", key, err)
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+
+	case reflect.Struct:
+		comp, ok := e.(*ast.CompositeLit)
+		if !ok {
+			return errors.New("struct literal expected")
+		}
+		for _, elt := range comp.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				return errors.New("field: value expected")
+			}
+			name, ok := kv.Key.(*ast.Ident)
+			if !ok {
+				return errors.New("field name expected")
+			}
+			field := v.FieldByName(name.Name)
+			if !field.IsValid() || !field.CanSet() {
+				return errors.New("unknown field " + name.Name)
+			}
+			if err := setLiteral(field, kv.Value); err != nil {
+				return fmt.Errorf("%s: %v", name.Name, err)
+			}
+		}
+
+	default:
+		return errors.New("unsupported type " + v.Type().String())
+	}
+	return nil
+}
+
+// goTableEntry returns the line of an entry in the Go table.
+func goTableEntry(name string, v paket.Values) string {
+	chunk := ""
+	if v.ChunkSize > 0 {
+		chunk = fmt.Sprintf(", ChunkSize : %d", v.ChunkSize)
+	}
+	if v.AAD {
+		chunk += ", AAD : true"
+	}
+	return fmt.Sprintf(goTemplate, name, strconv.Itoa(v.StartPos), strconv.Itoa(v.EndPos), strconv.Itoa(v.OriginalLenght), strconv.Itoa(v.EncryptLenght),
+		byteSliceLiteral(v.HashOriginal), byteSliceLiteral(v.HashEncrypt), byteSliceLiteral(v.Nonce), v.Compression, v.CompressedLenght, chunk)
+}
+
+// byteSliceLiteral returns b as a Go literal, like "[]byte{1, 2, 3}". It is "nil" for empty b.
+func byteSliceLiteral(b []byte) string {
+	if len(b) == 0 {
+		return "nil"
+	}
+	nums := make([]string, len(b))
+	for i, n := range b {
+		nums[i] = strconv.Itoa(int(n))
+	}
+	return "[]byte{" + strings.Join(nums, ", ") + "}"
+}
+
+// goTableSignature returns the PaketSignature declaration of the Go table. It is empty if the paket is not signed.
+func goTableSignature(signature []byte) string {
+	if len(signature) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(signatureTemplate, byteSliceLiteral(signature))
+}
+
+// writeGoTable writes a new Go table after the entries of a legacy paket are changed.
+// opt.Table, opt.Salt, opt.ID, opt.EntryKeys, opt.KDF and opt.Signature are written.
+// The table is written to a temporary file and renamed, the old table is not lost if there is an error.
+func writeGoTable(path string, opt paket.Option) error {
+	tmp, err := writeGoTableTemp(path, opt)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// writeGoTableTemp writes the Go table to a new temporary file next to path and returns its name.
+// The caller renames it to path.
+func writeGoTableTemp(path string, opt paket.Option) (string, error) {
+	names := make([]string, 0, len(opt.Table))
+	for name := range opt.Table {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	kdf := opt.KDF
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf(toptemplate, opt.Salt, byteSliceLiteral(opt.ID), opt.EntryKeys, kdf.Algorithm, kdf.Iteration, kdf.N, kdf.R, kdf.P, kdf.Time, kdf.Memory, kdf.Threads))
+	for _, name := range names {
+		b.WriteString(goTableEntry(name, opt.Table[name]))
+	}
+	b.WriteString("}")
+	b.WriteString(goTableSignature(opt.Signature))
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	// CreateTemp creates the file only readable by the user.
+	err = tmp.Chmod(0644)
+	if err == nil {
+		_, err = tmp.WriteString(b.String())
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
@@ -0,0 +1,270 @@
+// Copyright (C) 2021 SeanTolstoyevski - mailto:seantolstoyevski@protonmail.com
+//
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	paket "github.com/SeanTolstoyevski/paket/pengine"
+)
+
+// entryInfo is an entry of the table as printed by list.
+type entryInfo struct {
+	Name           string `json:"name"`
+	StartPos       int    `json:"start"`
+	EndPos         int    `json:"end"`
+	OriginalSize   int    `json:"originalSize"`
+	EncryptedSize  int    `json:"encryptedSize"`
+	CompressedSize int    `json:"compressedSize,omitempty"`
+	Compression    string `json:"compression,omitempty"`
+	ChunkSize      int    `json:"chunkSize,omitempty"`
+	HashOriginal   string `json:"hashOriginal"`
+	HashEncrypt    string `json:"hashEncrypt"`
+	Nonce          string `json:"nonce,omitempty"`
+}
+
+// problem is an error found by verify.
+type problem struct {
+	Name    string `json:"name"`
+	Problem string `json:"problem"`
+}
+
+// verifyResult is the JSON output of verify.
+type verifyResult struct {
+	OK       bool      `json:"ok"`
+	Entries  int       `json:"entries"`
+	Original bool      `json:"originalChecked"`
+	Root     string    `json:"root"`
+	Problems []problem `json:"problems"`
+}
+
+var compressionNames = map[paket.COMPRESSION]string{
+	paket.COMPRESSDEFLATE: "deflate",
+	paket.COMPRESSZSTD:    "zstd",
+}
+
+// runList prints the entries of a paket with their sizes, positions and hashes.
+//
+//	paket list -p data.pack -k my_secret_key -json
+func runList(args []string) {
+	flagSet := flag.NewFlagSet("list", flag.ExitOnError)
+	of := addOpenFlags(flagSet)
+	jsonOutput := flagSet.Bool("json", false, "print the entries as JSON.")
+	flagSet.Parse(args)
+
+	p, err := of.open()
+	if err != nil {
+		fmt.Println("Error: opening the paket:", err)
+		os.Exit(1)
+	}
+	defer p.Close()
+
+	var entries []entryInfo
+	for _, name := range p.Names() {
+		v, _ := p.Entry(name)
+		entries = append(entries, entryInfo{
+			Name:           name,
+			StartPos:       v.StartPos,
+			EndPos:         v.EndPos,
+			OriginalSize:   v.OriginalLenght,
+			EncryptedSize:  v.EncryptLenght,
+			CompressedSize: v.CompressedLenght,
+			Compression:    compressionNames[v.Compression],
+			ChunkSize:      v.ChunkSize,
+			HashOriginal:   hex.EncodeToString(v.HashOriginal),
+			HashEncrypt:    hex.EncodeToString(v.HashEncrypt),
+			Nonce:          hex.EncodeToString(v.Nonce),
+		})
+	}
+
+	if *jsonOutput {
+		if entries == nil {
+			entries = []entryInfo{}
+		}
+		printJSON(entries)
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tORIGINAL\tENCRYPTED\tSTART\tEND\tCOMPRESSION\tSHA256 ORIGINAL\tSHA256 ENCRYPTED")
+	for _, e := range entries {
+		compression := e.Compression
+		if compression == "" {
+			compression = "-"
+		} else {
+			compression = fmt.Sprintf("%s (%d)", compression, e.CompressedSize)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n", e.Name, e.OriginalSize, e.EncryptedSize, e.StartPos, e.EndPos, compression, e.HashOriginal, e.HashEncrypt)
+	}
+	tw.Flush()
+	if lengths, err := p.GetLen(); err == nil {
+		fmt.Printf("%d files, original: %d bytes, encrypted: %d bytes\n", len(entries), lengths[0], lengths[1])
+	}
+}
+
+// runVerify checks the positions and the hashes of all entries.
+// Exits with 1 if there is a problem.
+//
+//	paket verify -p data.pack -k my_secret_key
+func runVerify(args []string) {
+	flagSet := flag.NewFlagSet("verify", flag.ExitOnError)
+	of := addOpenFlags(flagSet)
+	jsonOutput := flagSet.Bool("json", false, "print the result as JSON.")
+	expectedRoot := flagSet.String("root", "", "The expected Merkle root of the paket, in hex. Printed by verify, it can be kept for each release.")
+	flagSet.Parse(args)
+
+	// A legacy paket can be checked without the key, only the encrypted hashes are checked then.
+	// The index of a container cannot be read without the key.
+	checkOriginal := *of.key != "" || *of.identity != ""
+
+	p, err := of.open()
+	if err != nil {
+		// a container with a truncated file or invalid positions in its index cannot be opened,
+		// it is a problem of the paket for the JSON output.
+		if *jsonOutput {
+			printJSON(openFailed(*of.pack, checkOriginal, err))
+		} else {
+			fmt.Println("Error: opening the paket:", err)
+		}
+		os.Exit(1)
+	}
+	defer p.Close()
+
+	info, err := os.Stat(*of.pack)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	problems := verifyPaket(p, info.Size(), checkOriginal)
+	root, err := p.MerkleRoot()
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if *expectedRoot != "" && !strings.EqualFold(*expectedRoot, hex.EncodeToString(root)) {
+		problems = append(problems, problem{Name: *of.pack, Problem: "merkle root does not match: " + hex.EncodeToString(root)})
+	}
+	result := verifyResult{OK: len(problems) == 0, Entries: len(p.Names()), Original: checkOriginal, Root: hex.EncodeToString(root), Problems: problems}
+	if result.Problems == nil {
+		result.Problems = []problem{}
+	}
+
+	if *jsonOutput {
+		printJSON(result)
+	} else {
+		for _, pr := range problems {
+			fmt.Printf("%s: %s\n", pr.Name, pr.Problem)
+		}
+		checked := "encrypted hashes"
+		if checkOriginal {
+			checked = "encrypted and original hashes"
+		}
+		fmt.Printf("%d files, %s checked, %d problems.\n", result.Entries, checked, len(problems))
+		fmt.Printf("merkle root: %s\n", result.Root)
+	}
+
+	if !result.OK {
+		// deferred Close is skipped by os.Exit.
+		p.Close()
+		os.Exit(1)
+	}
+}
+
+// openFailed returns the result of verify for a paket that cannot be opened.
+func openFailed(pack string, checkOriginal bool, err error) verifyResult {
+	return verifyResult{OK: false, Original: checkOriginal, Problems: []problem{{Name: pack, Problem: "cannot be opened: " + err.Error()}}}
+}
+
+// verifyPaket returns the problems of the entries of p.
+// size is the size of the paket file, used to find the truncated entries.
+func verifyPaket(p *paket.Paket, size int64, checkOriginal bool) []problem {
+	var problems []problem
+	add := func(name, format string, a ...interface{}) {
+		problems = append(problems, problem{Name: name, Problem: fmt.Sprintf(format, a...)})
+	}
+
+	names := p.Names()
+	// sorted by position for the overlap check.
+	sort.SliceStable(names, func(i, j int) bool {
+		a, _ := p.Entry(names[i])
+		b, _ := p.Entry(names[j])
+		return a.StartPos < b.StartPos
+	})
+
+	var prevName string
+	prevEnd := -1
+	for _, name := range names {
+		v, _ := p.Entry(name)
+
+		if v.EndPos-v.StartPos != v.EncryptLenght || v.StartPos < 0 {
+			add(name, "invalid position: %d-%d for %d encrypted bytes", v.StartPos, v.EndPos, v.EncryptLenght)
+			continue
+		}
+		if v.StartPos < prevEnd {
+			add(name, "overlaps %s: starts at %d, %s ends at %d", prevName, v.StartPos, prevName, prevEnd)
+		}
+		if v.EndPos > prevEnd {
+			prevName, prevEnd = name, v.EndPos
+		}
+		if int64(v.EndPos) > size {
+			add(name, "truncated: ends at %d, file size is %d", v.EndPos, size)
+			continue
+		}
+
+		_, ok, err := p.GetFile(name, false, true)
+		if err != nil {
+			add(name, "reading: %v", err)
+			continue
+		}
+		if !ok {
+			add(name, "hash of the encrypted data does not match the table")
+			continue
+		}
+
+		if checkOriginal {
+			if err := checkOriginalHash(p, name, v); err != nil {
+				add(name, "%v", err)
+			}
+		}
+	}
+	return problems
+}
+
+// checkOriginalHash decrypts the entry and compares its hash with HashOriginal.
+func checkOriginalHash(p *paket.Paket, name string, v paket.Values) error {
+	f, err := p.OpenFile(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if !bytes.Equal(h.Sum(nil), v.HashOriginal) {
+		return paket.ErrHashMismatch
+	}
+	return nil
+}
+
+// printJSON prints v as indented JSON.
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	errHandler(enc.Encode(v))
+}
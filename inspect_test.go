@@ -0,0 +1,135 @@
+// Copyright (C) 2021 SeanTolstoyevski - mailto:seantolstoyevski@protonmail.com
+//
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	paket "github.com/SeanTolstoyevski/paket/pengine"
+)
+
+// writeLegacyTestPaket writes a legacy paket with files and returns its Option.
+func writeLegacyTestPaket(t *testing.T, files map[string]string) paket.Option {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "legacy.pack")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	o := paket.Option{Key: []byte("test key"), PaketFile: path, Table: paket.Datas{}, Mode: paket.MODEGCM, Salt: "salt", ID: []byte("0123456789abcdef"), EntryKeys: true}
+	e, err := paket.OpenEditor(o, paket.EditorOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if _, err := e.Add(name, []byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	o.Table = e.Table()
+	return o
+}
+
+// verifyTestPaket opens the paket of o and returns the problems of verifyPaket as text.
+func verifyTestPaket(t *testing.T, o paket.Option) string {
+	t.Helper()
+	p, err := paket.New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	info, err := os.Stat(o.PaketFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	for _, pr := range verifyPaket(p, info.Size(), true) {
+		b.WriteString(pr.Name + ": " + pr.Problem + "\n")
+	}
+	return b.String()
+}
+
+func TestVerifyPaket(t *testing.T) {
+	files := map[string]string{"a.txt": "first file", "b.txt": "second file", "c.txt": strings.Repeat("third file ", 100)}
+
+	o := writeLegacyTestPaket(t, files)
+	if problems := verifyTestPaket(t, o); problems != "" {
+		t.Fatalf("valid paket: %s", problems)
+	}
+
+	// b.txt starts in a.txt.
+	overlap := o
+	overlap.Table = paket.Datas{}
+	for name, v := range o.Table {
+		overlap.Table[name] = v
+	}
+	b := overlap.Table["b.txt"]
+	b.StartPos -= 2
+	b.EndPos -= 2
+	overlap.Table["b.txt"] = b
+	if problems := verifyTestPaket(t, overlap); !strings.Contains(problems, "b.txt: overlaps a.txt") {
+		t.Errorf("overlap is not found: %s", problems)
+	}
+
+	// a byte of b.txt is changed.
+	data, err := os.ReadFile(o.PaketFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[o.Table["b.txt"].StartPos] ^= 1
+	if err := os.WriteFile(o.PaketFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if problems := verifyTestPaket(t, o); !strings.Contains(problems, "b.txt: hash of the encrypted data does not match") {
+		t.Errorf("changed entry is not found: %s", problems)
+	}
+
+	// the file ends in c.txt.
+	if err := os.Truncate(o.PaketFile, int64(o.Table["c.txt"].EndPos-10)); err != nil {
+		t.Fatal(err)
+	}
+	if problems := verifyTestPaket(t, o); !strings.Contains(problems, "c.txt: truncated") {
+		t.Errorf("truncated entry is not found: %s", problems)
+	}
+}
+
+// a truncated container loses its footer, verify reports it as a problem.
+func TestVerifyTruncatedContainer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pack")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := paket.NewWriter(f, paket.WriterOption{Key: []byte("test key"), Mode: paket.MODEGCM})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add("a.txt", []byte(strings.Repeat("a", 1000))); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := os.Truncate(path, 800); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = paket.New(paket.Option{Key: []byte("test key"), PaketFile: path})
+	if err == nil {
+		t.Fatal("truncated container is opened")
+	}
+	result := openFailed(path, true, err)
+	if result.OK || len(result.Problems) != 1 || result.Problems[0].Name != path || !strings.Contains(result.Problems[0].Problem, "cannot be opened") {
+		t.Errorf("result: %+v", result)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (C) 2021 SeanTolstoyevski - mailto:seantolstoyevski@protonmail.com
+//
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	paket "github.com/SeanTolstoyevski/paket/pengine"
+)
+
+// runKeygen creates a key pair and writes it as hex to <name>.key (private) and <name>.pub (public).
+//
+//	paket keygen -o client
+//	paket keygen -type ed25519 -o build
+func runKeygen(args []string) {
+	flagSet := flag.NewFlagSet("keygen", flag.ExitOnError)
+	keyType := flagSet.String("type", "x25519", "Type of the key pair. ''x25519'': a recipient of a paket (-r) and its identity (-identity).\n''ed25519'': signing a paket (-sign) and checking its signature (-trusted).")
+	output := flagSet.String("o", "paket", "Name of the key files. The private key is written to <name>.key, the public key to <name>.pub.")
+	flagSet.Parse(args)
+
+	var public, private []byte
+	var err error
+	switch strings.ToLower(*keyType) {
+	case "x25519":
+		public, private, err = paket.GenerateX25519Key()
+	case "ed25519":
+		public, private, err = paket.GenerateEd25519Key()
+	default:
+		fmt.Println("unknown key type:", *keyType)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Println("Error: creating the key:", err)
+		os.Exit(1)
+	}
+
+	privatePath, publicPath := *output+".key", *output+".pub"
+	for _, path := range []string{privatePath, publicPath} {
+		if paket.Exists(path) {
+			fmt.Printf("There is a file with this name (%s). Choose another name with -o.\n", path)
+			os.Exit(1)
+		}
+	}
+	if err := ioutil.WriteFile(privatePath, []byte(hex.EncodeToString(private)+"\n"), 0600); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if err := ioutil.WriteFile(publicPath, []byte(hex.EncodeToString(public)+"\n"), 0644); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("private key: %s (keep it secret)\npublic key: %s\n", privatePath, publicPath)
+}
+
+// readHexKey returns a key written as hex, or the key in a file written by keygen.
+func readHexKey(s string) ([]byte, error) {
+	if content, err := ioutil.ReadFile(s); err == nil {
+		s = string(content)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("key must be hex or a key file: %v", err)
+	}
+	return key, nil
+}
+
+// recipientFlags is a flag that can be given more than once, for the X25519 recipients.
+// Every value is a public key in hex or a .pub file, optionally prefixed by a slot name: "name=client.pub".
+type recipientFlags []string
+
+func (r *recipientFlags) String() string {
+	return strings.Join(*r, ",")
+}
+
+func (r *recipientFlags) Set(value string) error {
+	*r = append(*r, value)
+	return nil
+}
+
+// recipients parses the values of the flag.
+func (r recipientFlags) recipients() ([]paket.Recipient, error) {
+	var recipients []paket.Recipient
+	for _, value := range r {
+		var name string
+		if i := strings.IndexByte(value, '='); i >= 0 {
+			name, value = value[:i], value[i+1:]
+		}
+		key, err := readHexKey(value)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, paket.Recipient{Name: name, PublicKey: key})
+	}
+	return recipients, nil
+}
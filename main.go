@@ -10,6 +10,12 @@
 // 	paket -f=a_folder_path -k=my_secret_key -m=cfb -i=24000
 //
 // This command encrypts all the files in the 'a_folder_path' folder with 'my_secret_key' using AES 256, then write the hash information for each file in a table.
+//
+// By default the output is a container file: the mode, salt and iteration are saved in its header, and the table is saved encrypted at the end of the file.
+// With -legacy, the old format is written: only the encrypted data to -o, and the table as a Go file to -t.
+//
+// The commands work with an existing paket (see commands.go):
+// 	paket extract -p data.pack -k my_secret_key -o out
 package main
 
 import (
@@ -18,13 +24,11 @@ import (
 	"flag"
 	"fmt"
 	"golang.org/x/crypto/bcrypt" // for random salt
-	"golang.org/x/crypto/pbkdf2"
 
 	paket "github.com/SeanTolstoyevski/paket/pengine"
 	"io"
 	"io/ioutil"
 	"os"
-	"strconv"
 	"strings"
 )
 
@@ -32,37 +36,48 @@ var (
 	randBytes, raerr = paket.CreateRandomBytes(32)
 	keyDefault       = fmt.Sprintf("%x", sha256.Sum256(randBytes))
 
-	foldername      = flag.String("f", "", "Folder containing files to be encrypted. It is not recursive, Subfolders is not encrypted.")
+	foldername      = flag.String("f", "", "Folder containing files to be encrypted. Subfolders are included, the files are written to the table with their slash-separated relative paths (like ''textures/ui/button.png'').")
+	followLinks     = flag.Bool("symlinks", false, "follow symbolic links to files and folders. By default they are skipped.")
+	hiddenFiles     = flag.Bool("hidden", false, "include hidden files and folders (names starting with a dot). By default they are skipped.")
 	outputfile      = flag.String("o", "data.pack", "The file to which your encrypted data will be written. If there is a file with the same name, you will be warned.")
 	keyvalue        = flag.String("k", "", "Key for encrypting files. If this parameter is null, the tool generates one randomly bytes and prints value to the console.")
 	anonFileName    = flag.Bool("a", false, "anonymize file names. For example, the ''lion.zip'' file is written to the table with a name such as ''201bce5f''\nThis writes the names as ''original   	   random'' in a txt for you to remember later.")
-	eMode           = flag.String("m", "gcm", "The mode to be selected for encryption. Currently ''CFB'', ''CTR'', ''GCM'' and ''OFB'' are supported.")
+	eMode           = flag.String("m", "gcm", "The mode to be selected for encryption. Currently ''CBC'', ''CFB'', ''CTR'', ''GCM'', ''OFB'', ''CHACHA20'' (ChaCha20-Poly1305) and ''XCHACHA20'' (XChaCha20-Poly1305) are supported.")
+	compressName    = flag.String("c", "none", "Compression of the files before encryption: ''none'', ''deflate'' or ''zstd''.\nFiles that are already compressed (png, zip, mp3...) or that do not get smaller are written without compression.")
 	pbkdf2Iter      = flag.Uint("i", 4096, "Iteration count for pbkdf2. For less than 4096, 4096 will be selected.\nFor modern CPUs values like 100000 may be appropriate.")
-	tablefile       = flag.String("t", "PaketTable.go", "The go file to be written for Paket to read. When compiling this file, you must import it into your program.\nIt is created as \"package main.\"")
+	iterTemplate    = flag.String("itertemplate", "", "JSON template of a key derivation pipeline (a chain of hash functions and iteration counts).\nIf it is set, -kdf and -i are not used. The template is not saved with the paket,\nthe reader must pass the same pipeline with Option.Pipeline.")
+	kdfName         = flag.String("kdf", "pbkdf2", "Key derivation function: ''pbkdf2'', ''scrypt'' or ''argon2id''. Cost parameters can be added after a colon, like\n''scrypt:n=32768,r=8,p=1'' or ''argon2id:t=3,m=65536,p=4'' (m is in KiB). Saved with the paket.\nFor ''pbkdf2'' without parameters, -i is used.")
+	tablefile       = flag.String("t", "PaketTable.go", "The go file to be written for Paket to read. When compiling this file, you must import it into your program.\nIt is created as \"package main.\" Only used with -legacy.")
+	recipients      recipientFlags
+	signKey         = flag.String("sign", "", "Ed25519 private key (a .key file of ''paket keygen -type ed25519'', or hex) for signing the manifest of the paket.\nThe programs open it with the public key in Option.TrustedKey, see ''paket sign''.")
+	envelope        = flag.Bool("envelope", false, "encrypt the files with a random data key, kept in a key slot named ''default'' that is opened with -k.\nMore keys can be added later with ''paket slot add'', without encrypting the files again. Not used with -legacy.")
+	legacyFormat    = flag.Bool("legacy", false, "write the old format: raw encrypted data to -o and the table as a Go file to -t.\nBy default a container file is written and no Go table is needed.")
 	showprogressval = flag.Bool("s", true, "prints progress steps to the console. For example, which file is currently encrypting, etc.")
 )
 
 func main() {
+	// parsed here and not in init, so the tests of the package do not parse the flags of the test binary.
+	flag.Parse()
+	if flag.NArg() > 0 {
+		runCommand(flag.Arg(0), flag.Args()[1:])
+		return
+	}
+
 	if *foldername == "" {
 		fmt.Println("\"-f (folder)\" parameter cannot be null.\nSee", os.Args[0], "-help")
 		return
 	}
 
 	// mode check
-	var mode paket.MODE = 0
-	switch strings.ToLower(*eMode) {
-	case "cbc":
-		mode = paket.MODECBC
-	case "cfb":
-		mode = paket.MODECFB
-	case "ctr":
-		mode = paket.MODECTR
-	case "ofb":
-		mode = paket.MODEOFB
-	case "gcm":
-		mode = paket.MODEGCM
-	default:
-		fmt.Printf("%s is invalid encryption mode", *eMode)
+	mode, err := parseMode(*eMode)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	compression, err := parseCompression(*compressName)
+	if err != nil {
+		fmt.Println(err)
 		return
 	}
 
@@ -70,44 +85,105 @@ func main() {
 		*pbkdf2Iter = 4096
 	}
 
+	kdf, err := paket.ParseKDF(*kdfName)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if strings.ToLower(*kdfName) == "pbkdf2" {
+		kdf.Iteration = *pbkdf2Iter
+	}
+
+	var pipeline *paket.KeyDerivationPipeline
+	if *iterTemplate != "" {
+		pipeline, err = paket.LoadKeyDerivationPipeline(*iterTemplate)
+		if err != nil {
+			fmt.Println("Error: loading the iteration template:", err)
+			return
+		}
+		kdf = paket.KDF{Algorithm: paket.KDFPIPELINE}
+	}
+
 	if *showprogressval {
 		fmt.Println("--- INFO ---")
 		fmt.Println("Mode:", *eMode)
-		fmt.Println("PBDFK2 iteration:", *pbkdf2Iter)
+		fmt.Println("KDF:", kdf)
+		fmt.Println("Compression:", *compressName)
+		if *iterTemplate != "" {
+			fmt.Println("Iteration template:", *iterTemplate)
+		}
 		fmt.Println("Anonymizing file names:", *anonFileName)
+		fmt.Println("Legacy format:", *legacyFormat)
 	}
 
-	var useKey []byte
+	recipientKeys, err := recipients.recipients()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if len(recipientKeys) > 0 && *legacyFormat {
+		fmt.Println("-r cannot be used with -legacy.")
+		return
+	}
 
-	randSalt, err := bcrypt.GenerateFromPassword(randBytes, 10)
-	errHandler(err)
+	var signingKey []byte
+	if *signKey != "" {
+		signingKey, err = readHexKey(*signKey)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
 
-	if *keyvalue == "" {
-		useKey = []byte(keyDefault)
+	var userKey []byte
+	if *keyvalue == "" && len(recipientKeys) > 0 {
+		// only the recipients can open the paket.
+	} else if *keyvalue == "" {
+		userKey = []byte(keyDefault)
 		fmt.Printf("Your random key: %s\n", keyDefault)
 	} else {
-		useKey = []byte(*keyvalue)
+		userKey = []byte(*keyvalue)
 		fmt.Printf("Your key is: %s\n", *keyvalue)
 	}
-	useKey = pbkdf2.Key(useKey, randSalt, int(*pbkdf2Iter), 32, sha256.New)
 
 	if paket.Exists(*outputfile) {
 		fmt.Printf("There is a file with this name (%s). You can rerun cmd tool  under a different name, rename the existing file, or delete it.", *outputfile)
 		return
 	}
 
-	if paket.Exists(*tablefile) {
-		fmt.Println("The table file will be recreate.")
-	}
-
-	gotablefile, err := os.Create(*tablefile)
-	errHandler(err)
-	defer gotablefile.Close()
-
 	packFile, err := os.Create(*outputfile)
 	errHandler(err)
 	defer packFile.Close()
 
+	// legacy: the key is derived here and the table is written as a Go file.
+	var useKey []byte
+	var randSalt []byte
+	var gotablefile *os.File
+	// container: the writer derives the key with its own salt and keeps the table.
+	var pw *paket.Writer
+
+	if *legacyFormat {
+		randSalt, err = bcrypt.GenerateFromPassword(randBytes, 10)
+		errHandler(err)
+		if pipeline != nil {
+			useKey, err = pipeline.Key(userKey, randSalt)
+		} else {
+			useKey, err = kdf.Key(userKey, randSalt)
+		}
+		errHandler(err)
+
+		if paket.Exists(*tablefile) {
+			fmt.Println("The table file will be recreate.")
+		}
+
+		gotablefile, err = os.Create(*tablefile)
+		errHandler(err)
+		defer gotablefile.Close()
+	} else {
+		pw, err = paket.NewWriter(packFile, paket.WriterOption{Key: userKey, KDF: kdf, Pipeline: pipeline, Mode: mode, Compression: compression, Envelope: *envelope, Recipients: recipientKeys, SigningKey: signingKey})
+		errHandler(err)
+	}
+
 	var anonInfos *os.File
 	if *anonFileName {
 		var err error
@@ -117,68 +193,71 @@ func main() {
 		anonInfos.Write([]byte("original   \t   anonymous\r\n\r\n"))
 	}
 
-	allFolderFiles, err := ioutil.ReadDir(*foldername)
+	fileList, err := collectFiles(*foldername, *followLinks, *hiddenFiles)
 	errHandler(err)
 
-	fileList := []os.FileInfo{}
-	for _, file := range allFolderFiles {
-		if !file.IsDir() {
-			fileList = append(fileList, file)
-		}
-	}
-
 	if *showprogressval {
 		fmt.Printf("%d files were found in %s folder.\n", len(fileList), *foldername)
 	}
 
-	gotablefile.Write([]byte(fmt.Sprintf(toptemplate, string(randSalt))))
+	// legacy: the entries are sealed with the paket ID and their names, see paket.AssociatedData.
+	var paketID []byte
+	if *legacyFormat {
+		paketID, err = paket.CreateRandomBytes(16)
+		errHandler(err)
+		gotablefile.Write([]byte(fmt.Sprintf(toptemplate, string(randSalt), byteSliceLiteral(paketID), true, kdf.Algorithm, kdf.Iteration, kdf.N, kdf.R, kdf.P, kdf.Time, kdf.Memory, kdf.Threads)))
+	}
 
 	var start, full, end int = 0, 0, 0
+	// legacy: the table is kept for the signature.
+	legacyTable := make(paket.Datas)
 
 	for _, file := range fileList {
-		gcmNonce := make([]byte, 12)
-		if mode == 5 {
-			if _, err := io.ReadFull(rand.Reader, gcmNonce); err != nil {
-				errHandler(err)
-				return
-			}
-		}
-
-		name := file.Name()
+		name := file.name
 
 		if *showprogressval {
-			fmt.Printf("%s is  encrypting - size: %0.03f MB\n", name, float64(file.Size())/1024.0/1024.0)
+			fmt.Printf("%s is  encrypting - size: %0.03f MB\n", name, float64(file.size)/1024.0/1024.0)
 		}
 
-		content, err := ioutil.ReadFile(*foldername + "/" + name)
-		errHandler(err)
-		orgLen := len(content)
-		encData, err := paket.Encrypt(useKey, gcmNonce, content, mode)
+		content, err := ioutil.ReadFile(file.path)
 		errHandler(err)
-		encLen := len(encData)
-		originalHash := sha256.Sum256(content)
-		EncryptedHash := sha256.Sum256(encData)
-		orgStringTemplate := "[]byte{"
-		encStringTemplate := "[]byte{"
 
-		for _, oHI := range originalHash {
-			orgStringTemplate += fmt.Sprint(oHI, ", ")
+		if *anonFileName {
+			name = anonymize(anonInfos, name)
 		}
-		orgStringTemplate = orgStringTemplate[:len(orgStringTemplate)-2] + "}"
 
-		for _, eHI := range EncryptedHash {
-			encStringTemplate += fmt.Sprint(eHI, ", ")
+		if !*legacyFormat {
+			_, err := pw.Add(name, content)
+			errHandler(err)
+			continue
 		}
-		encStringTemplate = encStringTemplate[:len(encStringTemplate)-2] + "}"
 
-		nonceTableString := "[]byte{"
-		if mode == paket.MODEGCM {
-			for _, nonNum := range gcmNonce {
-				nonceTableString += fmt.Sprint(nonNum, ", ")
+		gcmNonce := make([]byte, paket.NonceSize(mode))
+		if len(gcmNonce) > 0 {
+			if _, err := io.ReadFull(rand.Reader, gcmNonce); err != nil {
+				errHandler(err)
+				return
 			}
-			nonceTableString = nonceTableString[:len(nonceTableString)-2] + "}"
 		}
 
+		orgLen := len(content)
+		stored, usedCompression, err := paket.Compress(name, content, compression)
+		errHandler(err)
+		compLen := 0
+		if usedCompression != paket.COMPRESSNONE {
+			compLen = len(stored)
+		}
+		// only the authenticated modes use the associated data.
+		var ad []byte
+		if len(gcmNonce) > 0 {
+			ad = paket.AssociatedData(0, paketID, name)
+		}
+		encData, err := paket.EncryptWithAD(paket.EntryKey(useKey, paketID, name), gcmNonce, stored, ad, mode)
+		errHandler(err)
+		encLen := len(encData)
+		originalHash := sha256.Sum256(content)
+		encryptedHash := sha256.Sum256(encData)
+
 		if _, err := packFile.Write(encData); err != nil {
 			errHandler(err)
 			return
@@ -188,24 +267,78 @@ func main() {
 		full += encLen
 		end = full
 
-		if *anonFileName {
-			randNames16, _ := paket.CreateRandomBytes(16)
-			randNames16 = randNames16[:7]
-			rname := fmt.Sprintf("%x", randNames16)
-			rname = rname[:7]
-			anonInfos.Write([]byte(name + "   \t   " + rname + "\r\n"))
-			name = rname
+		v := paket.Values{
+			StartPos:         start,
+			EndPos:           end,
+			OriginalLenght:   orgLen,
+			EncryptLenght:    encLen,
+			HashOriginal:     originalHash[:],
+			HashEncrypt:      encryptedHash[:],
+			Nonce:            gcmNonce,
+			Compression:      usedCompression,
+			CompressedLenght: compLen,
+			AAD:              ad != nil,
 		}
+		legacyTable[name] = v
+		gotablefile.Write([]byte(goTableEntry(name, v)))
+	}
 
-		if mode == paket.MODEGCM {
-			gotablefile.Write([]byte(fmt.Sprintf(goTemplate, name, strconv.Itoa(start), strconv.Itoa(end), strconv.Itoa(orgLen), strconv.Itoa(encLen), orgStringTemplate, encStringTemplate, nonceTableString)))
-		} else {
-			gotablefile.Write([]byte(fmt.Sprintf(goTemplate, name, strconv.Itoa(start), strconv.Itoa(end), strconv.Itoa(orgLen), strconv.Itoa(encLen), orgStringTemplate, encStringTemplate, "nil")))
+	if *legacyFormat {
+		gotablefile.Write([]byte("}"))
+		if signingKey != nil {
+			signature, err := paket.Sign(paket.Option{Table: legacyTable, Salt: string(randSalt), ID: paketID, EntryKeys: true, KDF: kdf, Pipeline: pipeline, Mode: mode}, signingKey)
+			errHandler(err)
+			gotablefile.Write([]byte(goTableSignature(signature)))
 		}
+		return
+	}
+	errHandler(pw.Close())
+}
 
+// parseMode returns the mode for its name in the -m flag.
+func parseMode(name string) (paket.MODE, error) {
+	switch strings.ToLower(name) {
+	case "cbc":
+		return paket.MODECBC, nil
+	case "cfb":
+		return paket.MODECFB, nil
+	case "ctr":
+		return paket.MODECTR, nil
+	case "ofb":
+		return paket.MODEOFB, nil
+	case "gcm":
+		return paket.MODEGCM, nil
+	case "chacha20", "chacha20poly1305":
+		return paket.MODECHACHA20POLY1305, nil
+	case "xchacha20", "xchacha20poly1305":
+		return paket.MODEXCHACHA20POLY1305, nil
+	default:
+		return 0, fmt.Errorf("%s is invalid encryption mode", name)
 	}
+}
 
-	gotablefile.Write([]byte("}"))
+// parseCompression returns the compression for its name in the -c flag.
+func parseCompression(name string) (paket.COMPRESSION, error) {
+	switch strings.ToLower(name) {
+	case "none", "":
+		return paket.COMPRESSNONE, nil
+	case "deflate":
+		return paket.COMPRESSDEFLATE, nil
+	case "zstd":
+		return paket.COMPRESSZSTD, nil
+	default:
+		return 0, fmt.Errorf("%s is invalid compression", name)
+	}
+}
+
+// anonymize returns a random name for the file and writes the pair to the anonymization information file.
+func anonymize(anonInfos *os.File, name string) string {
+	randNames16, _ := paket.CreateRandomBytes(16)
+	randNames16 = randNames16[:7]
+	rname := fmt.Sprintf("%x", randNames16)
+	rname = rname[:7]
+	anonInfos.Write([]byte(name + "   \t   " + rname + "\r\n"))
+	return rname
 }
 
 func errHandler(err error) {
@@ -227,15 +360,30 @@ import (
 // salt
 const PaketSalt string = "%s"
 
+// random ID of the paket, the entries are bound to it. Pass it to Option.ID.
+var PaketID = %s
+
+// the entries are encrypted with their own subkeys. Pass it to Option.EntryKeys.
+var PaketEntryKeys = %t
+
+// key derivation function. Pass it to Option.KDF.
+var PaketKDF = paket.KDF{Algorithm: %d, Iteration: %d, N: %d, R: %d, P: %d, Time: %d, Memory: %d, Threads: %d}
+
 // The map vault for datas.
 var PaketData = map[string]paket.Values{
 `
 
-var goTemplate string = `	"%s" : {StartPos : %s, EndPos : %s, OriginalLenght : %s, EncryptLenght : %s, HashOriginal : %s, HashEncrypt : %s, Nonce: %s},
+var signatureTemplate string = `
+
+// Ed25519 signature of the manifest. Pass it to Option.Signature, with the public key in Option.TrustedKey.
+var PaketSignature = %s
+`
+
+var goTemplate string = `	%q : {StartPos : %s, EndPos : %s, OriginalLenght : %s, EncryptLenght : %s, HashOriginal : %s, HashEncrypt : %s, Nonce: %s, Compression : %d, CompressedLenght : %d%s},
 `
 
 func init() {
-	flag.Parse()
+	flag.Var(&recipients, "r", "X25519 public key (a .pub file of ''paket keygen'', or hex) that can open the paket with its private key. Can be given more than once.\nA slot name can be written before it: ''-r client-eu=eu.pub''. Without -k, only the recipients can open the paket.")
 	//handle randBytes error
 	if raerr != nil {
 		panic(raerr)
@@ -0,0 +1,64 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+var aeadModes = []MODE{MODEGCM, MODECHACHA20POLY1305, MODEXCHACHA20POLY1305}
+
+func TestAEAD(t *testing.T) {
+	key := testRandom(32)
+	data := []byte("hello paket")
+	ad := AssociatedData(FormatVersion, testRandom(16), "readme.txt")
+	for _, mode := range aeadModes {
+		nonce := testRandom(NonceSize(mode))
+		enc, err := EncryptWithAD(key, nonce, data, ad, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec, err := DecryptWithAD(key, nonce, enc, ad, mode)
+		if err != nil || !bytes.Equal(dec, data) {
+			t.Fatalf("mode %d: %v", mode, err)
+		}
+
+		if _, err := DecryptWithAD(key, nonce, enc, append(ad, 0), mode); err == nil {
+			t.Errorf("mode %d: other associated data is accepted", mode)
+		}
+		if _, err := Decrypt(key, nonce, enc, mode); err == nil {
+			t.Errorf("mode %d: opened without the associated data", mode)
+		}
+		changed := append([]byte(nil), enc...)
+		changed[0] ^= 1
+		if _, err := DecryptWithAD(key, nonce, changed, ad, mode); err == nil {
+			t.Errorf("mode %d: changed data is accepted", mode)
+		}
+		if _, err := DecryptWithAD(testRandom(31), nonce, enc, ad, mode); err == nil {
+			t.Errorf("mode %d: short key is accepted", mode)
+		}
+	}
+}
+
+func TestAEADNonceSize(t *testing.T) {
+	want := map[MODE]int{MODEGCM: 12, MODECHACHA20POLY1305: 12, MODEXCHACHA20POLY1305: 24, MODECTR: 0, MODECBC: 0}
+	for mode, size := range want {
+		if got := NonceSize(mode); got != size {
+			t.Errorf("NonceSize(%d) = %d, want %d", mode, got, size)
+		}
+	}
+	for _, mode := range aeadModes {
+		nonce := testRandom(NonceSize(mode) + 1)
+		if _, err := Encrypt(testRandom(32), nonce, []byte("data"), mode); !errors.Is(err, ErrInvalidNonce) {
+			t.Errorf("mode %d: Encrypt with a long nonce: %v, want ErrInvalidNonce", mode, err)
+		}
+		if _, err := Decrypt(testRandom(32), nonce[:NonceSize(mode)-1], testRandom(32), mode); !errors.Is(err, ErrInvalidNonce) {
+			t.Errorf("mode %d: Decrypt with a short nonce: %v, want ErrInvalidNonce", mode, err)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"errors"
+	"sync"
+)
+
+// ErrCacheDisabled is returned by Pin when Option.CacheSize is 0.
+var ErrCacheDisabled = errors.New("cache is not enabled, see Option.CacheSize")
+
+// CacheStats keeps the counters of the decrypted entry cache. See Paket.CacheStats.
+type CacheStats struct {
+	// number of requests served from the cache, and the requests that had to read and decrypt the entry.
+	Hits   uint64
+	Misses uint64
+
+	// number of entries in the cache and their total size in bytes. Pinned entries are included.
+	Entries int
+	Bytes   int64
+
+	// number of pinned entries.
+	Pinned int
+}
+
+// cache keeps decrypted entries up to a byte budget.
+// The least recently used entries are removed first. Pinned entries are never removed by the budget.
+//
+// Only entries whose hash matches the table are stored.
+type cache struct {
+	mu sync.Mutex
+
+	budget int64
+
+	size int64
+
+	// unpinned entries, the most recently used at the front.
+	lru *list.List
+
+	items map[string]*cacheItem
+
+	hits, misses uint64
+}
+
+type cacheItem struct {
+	name string
+
+	data []byte
+
+	// element in lru. nil for the pinned entries.
+	elem *list.Element
+}
+
+func newCache(budget int64) *cache {
+	return &cache{budget: budget, lru: list.New(), items: make(map[string]*cacheItem)}
+}
+
+// get returns a copy of the cached data, so the caller can change it.
+func (c *cache) get(name string) ([]byte, bool) {
+	return c.lookup(name, true)
+}
+
+// lookup is get. countMiss is false for the readers that do not add the entry to the cache after a miss (GetRange),
+// a miss is not counted for them.
+func (c *cache) lookup(name string, countMiss bool) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, found := c.items[name]
+	if !found {
+		if countMiss {
+			c.misses++
+		}
+		return nil, false
+	}
+	c.hits++
+	if item.elem != nil {
+		c.lru.MoveToFront(item.elem)
+	}
+	return append([]byte(nil), item.data...), true
+}
+
+// add stores a copy of data. Data larger than the budget is not stored.
+func (c *cache) add(name string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, found := c.items[name]; found || int64(len(data)) > c.budget {
+		return
+	}
+	item := &cacheItem{name: name, data: append([]byte(nil), data...)}
+	item.elem = c.lru.PushFront(item)
+	c.items[name] = item
+	c.size += int64(len(data))
+	c.shrink()
+}
+
+// pin stores data if it is not in the cache and keeps it until unpin.
+func (c *cache) pin(name string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, found := c.items[name]
+	if !found {
+		item = &cacheItem{name: name, data: append([]byte(nil), data...)}
+		c.items[name] = item
+		c.size += int64(len(data))
+	} else if item.elem != nil {
+		c.lru.Remove(item.elem)
+	}
+	item.elem = nil
+	c.shrink()
+}
+
+// unpin makes a pinned entry a normal entry, the most recently used one.
+func (c *cache) unpin(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, found := c.items[name]
+	if !found || item.elem != nil {
+		return
+	}
+	item.elem = c.lru.PushFront(item)
+	c.shrink()
+}
+
+// isPinned reports whether the entry is pinned.
+func (c *cache) isPinned(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, found := c.items[name]
+	return found && item.elem == nil
+}
+
+// evict removes an unpinned entry.
+func (c *cache) evict(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if item, found := c.items[name]; found && item.elem != nil {
+		c.remove(item)
+	}
+}
+
+// purge removes all unpinned entries.
+func (c *cache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.lru.Len() > 0 {
+		c.remove(c.lru.Back().Value.(*cacheItem))
+	}
+}
+
+// clear removes all entries, also the pinned entries. It is called by Paket.Close.
+func (c *cache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.items = make(map[string]*cacheItem)
+	c.size = 0
+}
+
+// shrink removes the least recently used entries until the cache is in its budget.
+// c.mu must be held.
+func (c *cache) shrink() {
+	for c.size > c.budget && c.lru.Len() > 0 {
+		c.remove(c.lru.Back().Value.(*cacheItem))
+	}
+}
+
+// remove removes an unpinned entry. c.mu must be held.
+func (c *cache) remove(item *cacheItem) {
+	c.lru.Remove(item.elem)
+	delete(c.items, item.name)
+	c.size -= int64(len(item.data))
+}
+
+func (c *cache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Hits:    c.hits,
+		Misses:  c.misses,
+		Entries: len(c.items),
+		Bytes:   c.size,
+		Pinned:  len(c.items) - c.lru.Len(),
+	}
+}
+
+// cacheGet returns the cached data of the entry. It counts the hit or miss.
+func (p *Paket) cacheGet(name string) ([]byte, bool) {
+	if p.cache == nil {
+		return nil, false
+	}
+	return p.cache.get(name)
+}
+
+// cachePeek returns the cached data of the entry. Only a hit is counted,
+// because the entry is not decrypted and added to the cache after a miss.
+func (p *Paket) cachePeek(name string) ([]byte, bool) {
+	if p.cache == nil {
+		return nil, false
+	}
+	return p.cache.lookup(name, false)
+}
+
+// cacheAdd stores the decrypted data of the entry if its hash is correct.
+// hashOK tells if the hash was already checked by the caller. If it is false, the hash is calculated here.
+func (p *Paket) cacheAdd(name string, v Values, data []byte, hashOK bool) {
+	if p.cache == nil {
+		return
+	}
+	if !hashOK {
+		sum := sha256.Sum256(data)
+		if !bytes.Equal(sum[:], v.HashOriginal) {
+			return
+		}
+	}
+	p.cache.add(name, data)
+}
+
+// Pin decrypts the entry, if it is not in the cache, and keeps it in the cache until Unpin.
+// Pinned entries are not removed by the byte budget, Purge or Evict. They are counted in the budget,
+// so too many pinned entries leave no room for the others.
+//
+// Returns ErrCacheDisabled if Option.CacheSize is 0, and ErrHashMismatch if the hash of the entry is wrong.
+func (p *Paket) Pin(name string) error {
+	if p.cache == nil {
+		return ErrCacheDisabled
+	}
+	if p.cache.isPinned(name) {
+		return nil
+	}
+	data, ok, err := p.GetFile(name, true, true)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrHashMismatch
+	}
+	p.cache.pin(name, data)
+	return nil
+}
+
+// Unpin makes a pinned entry a normal cache entry. It can be removed when the cache is full.
+func (p *Paket) Unpin(name string) {
+	if p.cache != nil {
+		p.cache.unpin(name)
+	}
+}
+
+// Evict removes the entry from the cache. Pinned entries are not removed, see Unpin.
+func (p *Paket) Evict(name string) {
+	if p.cache != nil {
+		p.cache.evict(name)
+	}
+}
+
+// Purge removes all entries from the cache, except the pinned entries.
+func (p *Paket) Purge() {
+	if p.cache != nil {
+		p.cache.purge()
+	}
+}
+
+// CacheStats returns the counters of the cache. It is the zero value if the cache is not enabled.
+func (p *Paket) CacheStats() CacheStats {
+	if p.cache == nil {
+		return CacheStats{}
+	}
+	return p.cache.stats()
+}
@@ -0,0 +1,152 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCacheLRU(t *testing.T) {
+	c := newCache(30)
+	c.add("a", make([]byte, 10))
+	c.add("b", make([]byte, 10))
+	c.add("c", make([]byte, 10))
+	// "a" is used, so "b" is the least recently used entry.
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("a is not in the cache")
+	}
+	c.add("d", make([]byte, 10))
+	if _, ok := c.get("b"); ok {
+		t.Error("b is not removed")
+	}
+	for _, name := range []string{"a", "c", "d"} {
+		if _, ok := c.get(name); !ok {
+			t.Errorf("%s is removed", name)
+		}
+	}
+	if s := c.stats(); s.Entries != 3 || s.Bytes != 30 {
+		t.Errorf("stats: %+v", s)
+	}
+
+	// data larger than the budget is not stored and does not remove the others.
+	c.add("large", make([]byte, 31))
+	if _, ok := c.get("large"); ok {
+		t.Error("data larger than the budget is stored")
+	}
+	if s := c.stats(); s.Entries != 3 {
+		t.Errorf("entries after a large add: %d", s.Entries)
+	}
+
+	// the cached data is a copy.
+	data := []byte("0123456789")
+	c.purge()
+	c.add("e", data)
+	data[0] = 'x'
+	got, _ := c.get("e")
+	got[1] = 'x'
+	if again, _ := c.get("e"); string(again) != "0123456789" {
+		t.Errorf("cached data is changed: %q", again)
+	}
+}
+
+func TestCachePin(t *testing.T) {
+	c := newCache(20)
+	c.pin("pinned", make([]byte, 10))
+	c.add("a", make([]byte, 10))
+	c.add("b", make([]byte, 10))
+	if _, ok := c.get("pinned"); !ok {
+		t.Fatal("pinned entry is removed by the budget")
+	}
+	if _, ok := c.get("a"); ok {
+		t.Error("a is not removed, the pinned entry is counted in the budget")
+	}
+
+	c.evict("pinned")
+	c.purge()
+	if s := c.stats(); s.Entries != 1 || s.Pinned != 1 {
+		t.Fatalf("Evict or Purge removed a pinned entry: %+v", s)
+	}
+
+	c.unpin("pinned")
+	if s := c.stats(); s.Pinned != 0 || s.Entries != 1 {
+		t.Fatalf("stats after unpin: %+v", s)
+	}
+	c.evict("pinned")
+	if s := c.stats(); s.Entries != 0 || s.Bytes != 0 {
+		t.Errorf("stats after evict: %+v", s)
+	}
+}
+
+func TestPaketCache(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM}, testFiles)
+	p := openTestPaket(t, path)
+	if err := p.Pin("readme.txt"); !errors.Is(err, ErrCacheDisabled) {
+		t.Errorf("Pin without cache: %v, want ErrCacheDisabled", err)
+	}
+	if s := p.CacheStats(); s != (CacheStats{}) {
+		t.Errorf("CacheStats without cache: %+v", s)
+	}
+	p.Close()
+
+	// the budget keeps one of the large entries.
+	logo, index := len(testFiles["ui/img/logo.bin"]), len(testFiles["ui/index.html"])
+	p, err := New(Option{Key: []byte("test key"), PaketFile: path, CacheSize: int64(logo + index)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	checkTestFiles(t, p)
+	s := p.CacheStats()
+	if s.Misses == 0 || s.Bytes > int64(logo+index) {
+		t.Fatalf("stats after the first read: %+v", s)
+	}
+
+	if err := p.Pin("ui/img/logo.bin"); err != nil {
+		t.Fatal(err)
+	}
+	p.Purge()
+	if s := p.CacheStats(); s.Entries != 1 || s.Pinned != 1 || s.Bytes != int64(logo) {
+		t.Fatalf("stats after Purge: %+v", s)
+	}
+	hits := p.CacheStats().Hits
+	data, ok, err := p.GetFile("ui/img/logo.bin", true, true)
+	if err != nil || !ok || !bytes.Equal(data, testFiles["ui/img/logo.bin"]) {
+		t.Fatalf("GetFile of a pinned entry: %v, %v", ok, err)
+	}
+	if p.CacheStats().Hits != hits+1 {
+		t.Error("pinned entry is not read from the cache")
+	}
+
+	p.Evict("ui/img/logo.bin")
+	if s := p.CacheStats(); s.Pinned != 1 {
+		t.Error("Evict removed a pinned entry")
+	}
+	p.Unpin("ui/img/logo.bin")
+	p.Evict("ui/img/logo.bin")
+	if s := p.CacheStats(); s.Entries != 0 {
+		t.Errorf("stats after Unpin and Evict: %+v", s)
+	}
+}
+
+func TestPinHashMismatch(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODECTR}, testFiles)
+	v, _ := openTestPaket(t, path).Entry("ui/index.html")
+	corruptEntry(t, path, v)
+	p, err := New(Option{Key: []byte("test key"), PaketFile: path, CacheSize: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err := p.Pin("ui/index.html"); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("Pin: %v, want ErrHashMismatch", err)
+	}
+	p.GetFile("ui/index.html", true, true)
+	if s := p.CacheStats(); s.Entries != 0 {
+		t.Errorf("an entry with a wrong hash is cached: %+v", s)
+	}
+}
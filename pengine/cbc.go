@@ -0,0 +1,90 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+var (
+	// ErrAuthentication is returned when the HMAC of CBC data does not match.
+	// The data or the key is wrong.
+	ErrAuthentication = errors.New("message authentication failed")
+
+	// ErrPadding is returned when the PKCS#7 padding of CBC data is not valid.
+	ErrPadding = errors.New("cbc: invalid padding")
+)
+
+// cbcMACKey derives the HMAC key of the CBC mode from the encryption key.
+// The same key is never used for both AES and HMAC.
+func cbcMACKey(key []byte) []byte {
+	macKey := make([]byte, sha256.Size)
+	// hkdf can only fail for very long outputs.
+	io.ReadFull(hkdf.New(sha256.New, key, nil, []byte("paket cbc hmac-sha256")), macKey)
+	return macKey
+}
+
+// cbcMAC returns the HMAC-SHA256 of the IV and the encrypted blocks.
+func cbcMAC(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, cbcMACKey(key))
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// sealCBC pads and encrypts data in CBC mode and adds the HMAC.
+// Output: IV + encrypted blocks + HMAC.
+func sealCBC(block cipher.Block, key, data []byte) ([]byte, error) {
+	padLen := aes.BlockSize - len(data)%aes.BlockSize
+	out := make([]byte, aes.BlockSize+len(data)+padLen, aes.BlockSize+len(data)+padLen+sha256.Size)
+	iv := out[:aes.BlockSize]
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+
+	body := out[aes.BlockSize:]
+	copy(body, data)
+	copy(body[len(data):], bytes.Repeat([]byte{byte(padLen)}, padLen))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(body, body)
+
+	return append(out, cbcMAC(key, out)...), nil
+}
+
+// openCBC checks the HMAC, then decrypts and unpads the data.
+func openCBC(block cipher.Block, key, data []byte) ([]byte, error) {
+	if len(data) < aes.BlockSize+aes.BlockSize+sha256.Size {
+		return nil, ErrShortData
+	}
+	sealed := data[:len(data)-sha256.Size]
+	if len(sealed)%aes.BlockSize != 0 {
+		return nil, errors.New("cbc: data is not a multiple of the block size")
+	}
+	if !hmac.Equal(cbcMAC(key, sealed), data[len(sealed):]) {
+		return nil, ErrAuthentication
+	}
+
+	raw := make([]byte, len(sealed)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, sealed[:aes.BlockSize]).CryptBlocks(raw, sealed[aes.BlockSize:])
+
+	padLen := int(raw[len(raw)-1])
+	if padLen == 0 || padLen > aes.BlockSize {
+		return nil, ErrPadding
+	}
+	for _, b := range raw[len(raw)-padLen:] {
+		if int(b) != padLen {
+			return nil, ErrPadding
+		}
+	}
+	return raw[:len(raw)-padLen], nil
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+func TestCBC(t *testing.T) {
+	key := testRandom(32)
+	for n := 0; n <= 3*aes.BlockSize+1; n++ {
+		data := testRandom(n)
+		enc, err := Encrypt(key, nil, data, MODECBC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a full block of padding is added to the data that fills the blocks.
+		padded := (n/aes.BlockSize + 1) * aes.BlockSize
+		if len(enc) != aes.BlockSize+padded+sha256.Size {
+			t.Fatalf("length %d: %d bytes of output", n, len(enc))
+		}
+		dec, err := Decrypt(key, nil, enc, MODECBC)
+		if err != nil || !bytes.Equal(dec, data) {
+			t.Fatalf("length %d: %v", n, err)
+		}
+	}
+}
+
+func TestCBCChanged(t *testing.T) {
+	key := testRandom(32)
+	enc, err := Encrypt(key, nil, []byte("hello paket"), MODECBC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the IV, the blocks and the HMAC are all authenticated.
+	for _, i := range []int{0, aes.BlockSize, len(enc) - 1} {
+		changed := append([]byte(nil), enc...)
+		changed[i] ^= 1
+		if _, err := Decrypt(key, nil, changed, MODECBC); !errors.Is(err, ErrAuthentication) {
+			t.Errorf("byte %d changed: %v, want ErrAuthentication", i, err)
+		}
+	}
+	other := append([]byte(nil), key...)
+	other[0] ^= 1
+	if _, err := Decrypt(other, nil, enc, MODECBC); !errors.Is(err, ErrAuthentication) {
+		t.Errorf("wrong key: %v, want ErrAuthentication", err)
+	}
+	if _, err := Decrypt(key, nil, enc[:len(enc)-aes.BlockSize-sha256.Size], MODECBC); !errors.Is(err, ErrShortData) {
+		t.Errorf("short data: %v, want ErrShortData", err)
+	}
+	if _, err := Decrypt(key, nil, append(enc, 0), MODECBC); err == nil {
+		t.Error("data that is not a multiple of the block size is accepted")
+	}
+}
+
+// the padding is checked after the HMAC. The data is sealed here with a valid HMAC but a wrong padding.
+func TestCBCPadding(t *testing.T) {
+	key := testRandom(32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pads := map[string][]byte{
+		"zero":     append(testRandom(15), 0),
+		"too long": append(testRandom(15), aes.BlockSize+1),
+		"mixed":    append(testRandom(13), 1, 3, 3),
+	}
+	for name, raw := range pads {
+		sealed := make([]byte, aes.BlockSize+len(raw))
+		copy(sealed, testRandom(aes.BlockSize))
+		cipher.NewCBCEncrypter(block, sealed[:aes.BlockSize]).CryptBlocks(sealed[aes.BlockSize:], raw)
+		sealed = append(sealed, cbcMAC(key, sealed)...)
+		if _, err := Decrypt(key, nil, sealed, MODECBC); !errors.Is(err, ErrPadding) {
+			t.Errorf("%s: %v, want ErrPadding", name, err)
+		}
+	}
+}
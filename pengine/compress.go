@@ -0,0 +1,111 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrDecompress is returned when a compressed entry cannot be decompressed
+// or its size is not the original length in the table.
+var ErrDecompress = errors.New("invalid compressed data")
+
+// incompressibleExts are the extensions of the files that are already compressed.
+// Compress does not try to compress these files.
+var incompressibleExts = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".avif": true,
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true, ".7z": true, ".rar": true,
+	".jar": true, ".apk": true, ".br": true, ".lz4": true,
+	".mp3": true, ".ogg": true, ".opus": true, ".aac": true, ".m4a": true, ".flac": true,
+	".mp4": true, ".webm": true, ".mkv": true, ".mov": true, ".avi": true,
+	".woff": true, ".woff2": true,
+}
+
+// minCompressGain is the minimum saving for keeping the compressed data, in percent.
+// If compression saves less, the data is stored without compression.
+const minCompressGain = 5
+
+// Compress compresses data before encryption if it is worth it. (for cmd tool and Writer)
+//
+// The file name is only used to skip the files that are already compressed (png, zip, mp3...).
+// Data that does not get at least 5% smaller is not compressed either.
+// The second value is the compression that was used, COMPRESSNONE if data is returned as it is.
+func Compress(name string, data []byte, c COMPRESSION) ([]byte, COMPRESSION, error) {
+	if c == COMPRESSNONE || len(data) == 0 || incompressibleExts[strings.ToLower(path.Ext(name))] {
+		return data, COMPRESSNONE, nil
+	}
+
+	var buf bytes.Buffer
+	switch c {
+	case COMPRESSDEFLATE:
+		w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, 0, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, 0, err
+		}
+	case COMPRESSZSTD:
+		w, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		buf.Write(w.EncodeAll(data, nil))
+		w.Close()
+	default:
+		return nil, 0, errors.New("invalid compression")
+	}
+
+	if buf.Len() > len(data)*(100-minCompressGain)/100 {
+		return data, COMPRESSNONE, nil
+	}
+	return buf.Bytes(), c, nil
+}
+
+// newDecompressor returns a reader that decompresses r.
+func newDecompressor(r io.Reader, c COMPRESSION) (io.ReadCloser, error) {
+	switch c {
+	case COMPRESSDEFLATE:
+		return flate.NewReader(r), nil
+	case COMPRESSZSTD:
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return nil, errors.New("invalid compression")
+	}
+}
+
+// decompress decompresses the data of an entry.
+// The result must be exactly size bytes, a larger output is not read to the end.
+func decompress(data []byte, c COMPRESSION, size int) ([]byte, error) {
+	r, err := newDecompressor(bytes.NewReader(data), c)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	out, err := ioutil.ReadAll(io.LimitReader(r, int64(size)+1))
+	if err != nil {
+		return nil, ErrDecompress
+	}
+	if len(out) != size {
+		return nil, ErrDecompress
+	}
+	return out, nil
+}
@@ -0,0 +1,68 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	text := testFiles["ui/index.html"]
+	for _, c := range []COMPRESSION{COMPRESSDEFLATE, COMPRESSZSTD} {
+		out, used, err := Compress("ui/index.html", text, c)
+		if err != nil || used != c || len(out) >= len(text) {
+			t.Fatalf("compression %d: %d bytes, %d, %v", c, len(out), used, err)
+		}
+		got, err := decompress(out, c, len(text))
+		if err != nil || !bytes.Equal(got, text) {
+			t.Fatalf("compression %d: decompress: %v", c, err)
+		}
+
+		// the size in the table must be the decompressed size.
+		for _, size := range []int{len(text) - 1, len(text) + 1} {
+			if _, err := decompress(out, c, size); !errors.Is(err, ErrDecompress) {
+				t.Errorf("compression %d, size %d: %v, want ErrDecompress", c, size, err)
+			}
+		}
+		if _, err := decompress(testRandom(100), c, len(text)); !errors.Is(err, ErrDecompress) {
+			t.Errorf("compression %d: invalid data: %v, want ErrDecompress", c, err)
+		}
+
+		// the data is stored as it is when compression is not worth it.
+		stored := map[string][]byte{
+			"logo.png":   text,
+			"MUSIC.MP3":  text,
+			"random.bin": testRandom(1000),
+			"empty.txt":  nil,
+		}
+		for name, data := range stored {
+			out, used, err := Compress(name, data, c)
+			if err != nil || used != COMPRESSNONE || !bytes.Equal(out, data) {
+				t.Errorf("compression %d, %s: %d, %v", c, name, used, err)
+			}
+		}
+	}
+
+	if _, _, err := Compress("readme.txt", text, 100); err == nil {
+		t.Error("invalid compression is accepted")
+	}
+}
+
+func TestCompressedEntries(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODECTR, Compression: COMPRESSZSTD}, testFiles)
+	p := openTestPaket(t, path)
+	checkTestFiles(t, p)
+	v, _ := p.Entry("ui/index.html")
+	if v.Compression != COMPRESSZSTD || v.CompressedLenght == 0 || v.CompressedLenght >= v.OriginalLenght {
+		t.Errorf("ui/index.html: %+v", v)
+	}
+	v, _ = p.Entry("ui/img/logo.bin")
+	if v.Compression != COMPRESSNONE || v.CompressedLenght != 0 {
+		t.Errorf("random data is compressed: %+v", v)
+	}
+}
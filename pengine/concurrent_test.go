@@ -0,0 +1,63 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// the readers share the Paket and one File, run with -race.
+func TestConcurrentReads(t *testing.T) {
+	for _, o := range []Option{{}, {Mmap: true}, {CacheSize: 1 << 16}} {
+		path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM, ChunkSize: 4096}, testFiles)
+		o.Key, o.PaketFile = []byte("test key"), path
+		p, err := New(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := testFiles["ui/img/logo.bin"]
+		shared, err := p.OpenFile("ui/img/logo.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errs := make(chan error, 64)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for name, data := range testFiles {
+					got, ok, err := p.GetFile(name, true, true)
+					if err != nil || !ok || !bytes.Equal(got, data) {
+						errs <- fmt.Errorf("GetFile(%q): %v, %v", name, ok, err)
+						return
+					}
+				}
+				off := int64(i * 5000)
+				got, err := p.GetRange("ui/img/logo.bin", off, 6000)
+				if err != nil || !bytes.Equal(got, want[off:off+6000]) {
+					errs <- fmt.Errorf("GetRange(%d): %v", off, err)
+					return
+				}
+				b := make([]byte, 6000)
+				if _, err := shared.ReadAt(b, off); err != nil || !bytes.Equal(b, want[off:off+6000]) {
+					errs <- fmt.Errorf("ReadAt(%d): %v", off, err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Errorf("%+v: %v", o, err)
+		}
+		shared.Close()
+		p.Close()
+	}
+}
@@ -10,7 +10,7 @@ type MODE uint8
 // Encryption / decryption modes
 const (
 
-	//
+	// CBC with PKCS#7 padding and HMAC-SHA256 (encrypt-then-MAC).
 	MODECBC MODE = 1
 
 	//
@@ -24,4 +24,53 @@ const (
 
 	//
 	MODEGCM MODE = 5
+
+	// ChaCha20-Poly1305 with 12 byte nonce. It does not use AES.
+	// Faster than the AES modes on CPUs without AES instructions (like many ARM devices).
+	MODECHACHA20POLY1305 MODE = 6
+
+	// XChaCha20-Poly1305 with 24 byte nonce.
+	// The nonce is long enough to be created randomly without risk of collision.
+	MODEXCHACHA20POLY1305 MODE = 7
+)
+
+type KDFMODE uint8
+
+// Key derivation functions
+const (
+
+	// PBKDF2 with sha256. Used when no KDF is selected.
+	KDFPBKDF2 KDFMODE = 1
+
+	// scrypt, memory-hard.
+	KDFSCRYPT KDFMODE = 2
+
+	// Argon2id, memory-hard. Recommended for the new files.
+	KDFARGON2ID KDFMODE = 3
+
+	// KeyDerivationPipeline. The stages are not saved with the paket, see Option.Pipeline.
+	KDFPIPELINE KDFMODE = 4
+
+	// No derivation, the key is a random 32 byte key and is used as it is.
+	// For the key slots of machines or builds that keep a raw key instead of a password.
+	KDFRAW KDFMODE = 5
+
+	// Not a password KDF: the key slot is sealed for an X25519 public key (see Recipient).
+	// It is opened with the private key in Option.Identity.
+	KDFX25519 KDFMODE = 6
+)
+
+type COMPRESSION uint8
+
+// Compression of the entries, before encryption
+const (
+
+	// not compressed
+	COMPRESSNONE COMPRESSION = 0
+
+	// deflate (compress/flate)
+	COMPRESSDEFLATE COMPRESSION = 1
+
+	// zstandard. Better ratio and faster decompression than deflate.
+	COMPRESSZSTD COMPRESSION = 2
 )
@@ -0,0 +1,391 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// ErrExists is returned by Editor.Add if there is already a file with the same name.
+var ErrExists = errors.New("file already exists in paket")
+
+// EditorOption keeps the settings for the new entries of an Editor.
+type EditorOption struct {
+	// Size of the chunks for the authenticated modes.
+	// If it is 0, DefaultChunkSize is used. Not used for the legacy files, their entries are one block.
+	ChunkSize int
+
+	// Compression of the new entries (see Compress).
+	Compression COMPRESSION
+}
+
+// Editor adds, replaces and removes the entries of an existing paket without encrypting the other entries again.
+// It should be created with OpenEditor.
+//
+// New data is always written to the end of the file. Replaced and removed entries stay in the file as dead space,
+// until the file is rewritten with Compact.
+//
+// For container files, the first change copies the file without its index to a temporary file next to it,
+// and the new entries are written to the copy. Close writes the new index to the copy, syncs it and renames it over the old file.
+// So the old file is not changed if the program stops before Close, only the temporary file is left.
+// For legacy files, the table is not in the file. Get it with Table after the changes and save it (the cmd tool writes a new Go table).
+// Their new entries are written to the end of the file, the old table is still valid for it.
+type Editor struct {
+	file *os.File
+
+	// copy of a container with the changes, created by the first change (see output). nil for the legacy files.
+	tmp *tempFile
+
+	// permissions of the file, for the copy.
+	perm os.FileMode
+
+	// position of the index of a container, the end of the data copied to tmp.
+	indexOffset int64
+
+	key []byte
+
+	mode MODE
+
+	// nil for the legacy files.
+	header *Header
+
+	// preamble and header of a container, the associated data of the index.
+	head []byte
+
+	// paket ID of a legacy file (Option.ID).
+	id []byte
+
+	// the entries of a legacy file have their own keys (Option.EntryKeys).
+	entryKeys bool
+
+	table Datas
+
+	chunkSize int
+
+	compression COMPRESSION
+
+	// position of the next entry, the end of the written data.
+	offset int64
+
+	// end of the header of a container.
+	dataStart int64
+
+	changed bool
+
+	closed bool
+}
+
+// OpenEditor opens a paket for changing its entries.
+//
+// o is the same as for New. For the legacy files o.Table is copied, it is not changed by the Editor.
+func OpenEditor(o Option, eo EditorOption) (*Editor, error) {
+	if eo.ChunkSize < 0 {
+		return nil, errors.New("negative chunk size")
+	}
+	if eo.ChunkSize == 0 {
+		eo.ChunkSize = DefaultChunkSize
+	}
+
+	// a container is not changed, the changes are written to a copy.
+	flag := os.O_RDWR
+	if o.Table == nil {
+		flag = os.O_RDONLY
+	}
+	f, err := os.OpenFile(o.PaketFile, flag, 0)
+	if err != nil {
+		return nil, err
+	}
+	fInfo, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	e := &Editor{file: f, perm: fInfo.Mode(), offset: fInfo.Size(), compression: eo.Compression}
+	if o.Table == nil {
+		h, dataStart, err := readHeader(f, fInfo.Size())
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		e.key, err = o.containerKey(h)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		idx, err := readIndex(f, fInfo.Size(), dataStart, e.key)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		e.head, err = readHead(f, dataStart)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		e.indexOffset, _, err = readFooter(f, fInfo.Size(), dataStart)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		// the new entries are written in place of the old index.
+		e.offset = e.indexOffset
+		e.table = idx.Entries
+		e.dataStart = dataStart
+		e.header = &h
+		e.mode = h.Mode
+		e.chunkSize = eo.ChunkSize
+		return e, nil
+	}
+
+	e.key, err = o.legacyKey()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	e.table = make(Datas, len(o.Table))
+	for name, v := range o.Table {
+		e.table[name] = v
+	}
+	e.mode = o.Mode
+	e.id = o.ID
+	e.entryKeys = o.EntryKeys
+	return e, nil
+}
+
+// Add encrypts data and writes it to the end of the paket under name.
+// Returns ErrExists if there is already a file with this name, see Replace.
+func (e *Editor) Add(name string, data []byte) (Values, error) {
+	if _, found := e.table[name]; found {
+		return Values{}, ErrExists
+	}
+	return e.write(name, data)
+}
+
+// Replace writes the new data of an existing file to the end of the paket.
+// The old data stays in the file until Compact.
+func (e *Editor) Replace(name string, data []byte) (Values, error) {
+	if _, found := e.table[name]; !found {
+		return Values{}, errors.New("File not found on map: " + name)
+	}
+	return e.write(name, data)
+}
+
+// Remove removes the file from the table.
+// Its data stays in the file until Compact.
+func (e *Editor) Remove(name string) error {
+	if e.closed {
+		return errors.New("editor is closed")
+	}
+	if _, found := e.table[name]; !found {
+		return errors.New("File not found on map: " + name)
+	}
+	delete(e.table, name)
+	e.changed = true
+	return nil
+}
+
+// Table returns the current table of the paket. It must not be changed.
+//
+// For legacy files, this is the table to save after the changes.
+func (e *Editor) Table() Datas {
+	return e.table
+}
+
+// write encrypts data and writes it to the end of the file.
+func (e *Editor) write(name string, data []byte) (Values, error) {
+	if e.closed {
+		return Values{}, errors.New("editor is closed")
+	}
+	ad, key := AssociatedData(0, e.id, name), e.key
+	if e.entryKeys {
+		key = EntryKey(e.key, e.id, name)
+	}
+	if e.header != nil {
+		ad = AssociatedData(e.header.Version, e.header.ID, name)
+		key = EntryKey(e.key, e.header.ID, name)
+	}
+	v, encData, err := sealEntry(key, e.mode, e.chunkSize, e.compression, name, data, ad)
+	if err != nil {
+		return Values{}, err
+	}
+	out, err := e.output()
+	if err != nil {
+		return Values{}, err
+	}
+	if _, err := out.WriteAt(encData, e.offset); err != nil {
+		return Values{}, err
+	}
+	v.StartPos = int(e.offset)
+	v.EndPos = v.StartPos + len(encData)
+	e.offset = int64(v.EndPos)
+	e.table[name] = v
+	e.changed = true
+	return v, nil
+}
+
+// output returns the file the new entries are written to.
+// For a container, the file without its index is copied to a temporary file next to it the first time.
+func (e *Editor) output() (*os.File, error) {
+	if e.header == nil {
+		return e.file, nil
+	}
+	if e.tmp != nil {
+		return e.tmp.File, nil
+	}
+	tmp, err := createTemp(e.file.Name(), e.perm)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(tmp, io.NewSectionReader(e.file, 0, e.indexOffset)); err != nil {
+		tmp.remove()
+		return nil, err
+	}
+	e.tmp = tmp
+	return tmp.File, nil
+}
+
+// Close saves the changes and closes the file.
+//
+// For a container file with a change, the new index is written to the copy, and the copy is renamed over the old file.
+// If there is an error, the old file is not changed and the copy is removed.
+func (e *Editor) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	defer func() {
+		e.key = nil
+	}()
+
+	if e.header == nil {
+		if err := e.file.Sync(); err != nil {
+			e.file.Close()
+			return err
+		}
+		return e.file.Close()
+	}
+	if !e.changed {
+		return e.file.Close()
+	}
+
+	out, err := e.output()
+	if err == nil {
+		// the signature of the old entries is not kept, the paket must be signed again.
+		var tail []byte
+		tail, err = sealIndex(e.key, e.head, index{Entries: e.table}, e.offset)
+		if err == nil {
+			_, err = out.WriteAt(tail, e.offset)
+		}
+	}
+	if err != nil {
+		if e.tmp != nil {
+			e.tmp.remove()
+		}
+		e.file.Close()
+		return err
+	}
+	return e.tmp.commit(e.file.Close)
+}
+
+// Compact rewrites the paket without the dead space left by Editor.
+// The entries are copied as they are, they are not encrypted again.
+// The hash of the encrypted data of each entry is checked while copying.
+//
+// The new file is written next to the old one and renamed over it at the end,
+// so the old file is not changed if there is an error.
+//
+// o is the same as for New. Returns the new table: the positions of the entries change.
+// For legacy files, the returned table must be saved instead of the old one.
+func Compact(o Option) (Datas, error) {
+	src, err := os.Open(o.PaketFile)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	fInfo, err := src.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var key, head []byte
+	var table Datas
+	var dataStart int64
+	if o.Table == nil {
+		h, start, err := readHeader(src, fInfo.Size())
+		if err != nil {
+			return nil, err
+		}
+		key, err = o.containerKey(h)
+		if err != nil {
+			return nil, err
+		}
+		idx, err := readIndex(src, fInfo.Size(), start, key)
+		if err != nil {
+			return nil, err
+		}
+		head, err = readHead(src, start)
+		if err != nil {
+			return nil, err
+		}
+		table = idx.Entries
+		dataStart = start
+	} else {
+		table = o.Table
+	}
+
+	// in the order of the old file.
+	names := make([]string, 0, len(table))
+	for name := range table {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return table[names[i]].StartPos < table[names[j]].StartPos
+	})
+
+	newTable := make(Datas, len(table))
+	err = replaceFile(o.PaketFile, fInfo.Mode(), func(dst *os.File) error {
+		// header of a container is copied as it is.
+		if _, err := io.Copy(dst, io.NewSectionReader(src, 0, dataStart)); err != nil {
+			return err
+		}
+		offset := dataStart
+		for _, name := range names {
+			v := table[name]
+			h := sha256.New()
+			if _, err := io.Copy(io.MultiWriter(dst, h), io.NewSectionReader(src, int64(v.StartPos), int64(v.EncryptLenght))); err != nil {
+				return err
+			}
+			if !bytes.Equal(h.Sum(nil), v.HashEncrypt) {
+				return fmt.Errorf("%w: %s", ErrHashMismatch, name)
+			}
+			v.StartPos = int(offset)
+			v.EndPos = v.StartPos + v.EncryptLenght
+			offset = int64(v.EndPos)
+			newTable[name] = v
+		}
+		if key == nil {
+			return nil
+		}
+		// the positions change, so the signature is not kept.
+		tail, err := sealIndex(key, head, index{Entries: newTable}, offset)
+		if err != nil {
+			return err
+		}
+		_, err = dst.Write(tail)
+		return err
+	}, src.Close)
+	if err != nil {
+		return nil, err
+	}
+	return newTable, nil
+}
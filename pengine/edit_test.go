@@ -0,0 +1,117 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEditor(t *testing.T) {
+	for _, mode := range testModes {
+		path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: mode}, testFiles)
+		e, err := OpenEditor(Option{Key: []byte("test key"), PaketFile: path}, EditorOption{Compression: COMPRESSZSTD})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.Add("readme.txt", nil); err != ErrExists {
+			t.Fatalf("Add of an existing entry: %v", err)
+		}
+		if _, err := e.Add("new.txt", []byte("new entry")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.Replace("ui/index.html", []byte("<p>new</p>")); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Remove("sounds/click.wav"); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		p := openTestPaket(t, path)
+		want := map[string][]byte{
+			"readme.txt":      testFiles["readme.txt"],
+			"ui/img/logo.bin": testFiles["ui/img/logo.bin"],
+			"empty":           nil,
+			"new.txt":         []byte("new entry"),
+			"ui/index.html":   []byte("<p>new</p>"),
+		}
+		for name, content := range want {
+			data, ok, err := p.GetFile(name, true, true)
+			if err != nil || !ok || !bytes.Equal(data, content) {
+				t.Fatalf("mode %d, %s: %v, %v", mode, name, ok, err)
+			}
+		}
+		if _, ok, _ := p.GetFile("sounds/click.wav", true, true); ok {
+			t.Fatalf("mode %d: removed entry is found", mode)
+		}
+		if len(p.table) != len(want) {
+			t.Fatalf("mode %d: %d entries, want %d", mode, len(p.table), len(want))
+		}
+	}
+}
+
+// the old file stays readable if the program stops before Close.
+func TestEditorWithoutClose(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM}, testFiles)
+	old, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := OpenEditor(Option{Key: []byte("test key"), PaketFile: path}, EditorOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Add("new.txt", testRandom(10000)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Replace("readme.txt", []byte("changed")); err != nil {
+		t.Fatal(err)
+	}
+	// a stop of the program: the files are not closed by Close.
+	e.file.Close()
+	e.tmp.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, old) {
+		t.Fatal("the file is changed before Close")
+	}
+	checkTestFiles(t, openTestPaket(t, path))
+}
+
+// Close without a change does not write anything.
+func TestEditorNoChange(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM}, testFiles)
+	old, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := OpenEditor(Option{Key: []byte("test key"), PaketFile: path}, EditorOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, old) {
+		t.Fatal("the file is changed without a change")
+	}
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(path), "*.tmp"))
+	if err != nil || len(files) != 0 {
+		t.Fatalf("temporary files are left: %v", files)
+	}
+}
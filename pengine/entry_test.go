@@ -0,0 +1,91 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// checkSwapped checks that the two entries cannot be read after their values are swapped.
+func checkSwapped(t *testing.T, p *Paket, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if _, ok, err := p.GetFile(name, true, true); err == nil && ok {
+			t.Errorf("%s: the swapped entry is read", name)
+		}
+	}
+}
+
+// the associated data of the entries keeps the data of an entry from being read as another entry,
+// even when all of its values (with the hashes) are moved with it.
+func TestSwappedEntries(t *testing.T) {
+	for _, mode := range []MODE{MODEGCM, MODECHACHA20POLY1305, MODEXCHACHA20POLY1305} {
+		path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: mode, ChunkSize: 1024}, testFiles)
+		rewriteTestIndex(t, path, func(h *Header, idx *index) {
+			idx.Entries["readme.txt"], idx.Entries["sounds/click.wav"] = idx.Entries["sounds/click.wav"], idx.Entries["readme.txt"]
+		})
+		checkSwapped(t, openTestPaket(t, path), "readme.txt", "sounds/click.wav")
+	}
+}
+
+func TestSwappedLegacyEntries(t *testing.T) {
+	for _, mode := range []MODE{MODEGCM, MODECHACHA20POLY1305, MODEXCHACHA20POLY1305} {
+		path := filepath.Join(t.TempDir(), "legacy.pack")
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		// without entry keys, only the associated data separates the entries.
+		o := Option{Key: []byte("test key"), PaketFile: path, Table: Datas{}, Mode: mode, Salt: "legacy salt", ID: testRandom(16)}
+		e, err := OpenEditor(o, EditorOption{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, data := range testFiles {
+			if _, err := e.Add(name, data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		table := e.Table()
+		if !table["readme.txt"].AAD {
+			t.Fatalf("mode %d: the entry is written without associated data", mode)
+		}
+
+		o.Table = table
+		p, err := New(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTestFiles(t, p)
+		p.Close()
+
+		swapped := make(Datas, len(table))
+		for name, v := range table {
+			swapped[name] = v
+		}
+		swapped["readme.txt"], swapped["sounds/click.wav"] = table["sounds/click.wav"], table["readme.txt"]
+		o.Table = swapped
+		p, err = New(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSwapped(t, p, "readme.txt", "sounds/click.wav")
+		p.Close()
+
+		// the entries cannot be moved to a paket with another ID.
+		o.Table, o.ID = table, testRandom(17)
+		p, err = New(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSwapped(t, p, "readme.txt")
+		p.Close()
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"crypto/sha256"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// entryKeyInfo is written before the name of the entry in the HKDF info, so the subkeys cannot be used for anything else.
+const entryKeyInfo = "paket entry key v1\x00"
+
+// EntryKey derives the key of one entry from the key of the paket with HKDF-SHA256.
+// id is the random ID of the paket (Header.ID, or Option.ID for legacy files) and is used as the HKDF salt.
+// The subkey has the same length as key.
+//
+// The containers and the legacy pakets with Option.EntryKeys encrypt every entry with its own subkey.
+// Then the random nonces of the authenticated modes are only used a few times under one key,
+// and a subkey found in the memory of a program only opens its own entry.
+// The Writer, the Editor and GetFile derive the subkeys automatically, EntryKey is only needed to encrypt an entry by hand.
+func EntryKey(key, id []byte, name string) []byte {
+	subkey := make([]byte, len(key))
+	// hkdf can only fail for very long outputs.
+	io.ReadFull(hkdf.New(sha256.New, key, id, []byte(entryKeyInfo+name)), subkey)
+	return subkey
+}
+
+// entryKey returns the key of the entry: its subkey, or the key of the paket for the legacy files without entry keys.
+func (p *Paket) entryKey(name string) []byte {
+	switch {
+	case p.header != nil:
+		return EntryKey(p.key, p.header.ID, name)
+	case p.entryKeys:
+		return EntryKey(p.key, p.id, name)
+	}
+	return p.key
+}
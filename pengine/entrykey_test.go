@@ -0,0 +1,58 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"testing"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+func TestEntryKey(t *testing.T) {
+	key, id := testRandom(32), testRandom(16)
+	subkey := EntryKey(key, id, "readme.txt")
+
+	want := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, id, []byte("paket entry key v1\x00readme.txt")), want); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(subkey, want) {
+		t.Fatal("EntryKey is not HKDF-SHA256 with the ID as salt")
+	}
+	if len(EntryKey(key[:16], id, "readme.txt")) != 16 {
+		t.Error("the subkey of a 16 byte key is not 16 bytes")
+	}
+
+	others := [][]byte{
+		EntryKey(key, id, "readme.txt\x00"),
+		EntryKey(key, id, "Readme.txt"),
+		EntryKey(key, testRandom(17), "readme.txt"),
+		EntryKey(testRandom(33)[1:], id, "readme.txt"),
+		key,
+	}
+	for i, other := range others {
+		if bytes.Equal(other, subkey) {
+			t.Errorf("%d: the same subkey", i)
+		}
+	}
+}
+
+// the entries of a legacy paket with Option.EntryKeys cannot be read without it.
+func TestLegacyEntryKeys(t *testing.T) {
+	o := writeTestLegacyPaket(t, MODECTR)
+	o.EntryKeys = false
+	p, err := New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if _, ok, err := p.GetFile("ui/index.html", true, true); err == nil && ok {
+		t.Error("the entry is read with the key of the paket")
+	}
+}
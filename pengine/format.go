@@ -0,0 +1,288 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Layout of a paket container file written by Writer:
+//
+//	preamble  16 bytes: magic (8), format version (2), reserved (2), header length (4)
+//	header    JSON encoded Header: mode, KDF and its parameters, salt, key slots. Not encrypted.
+//	data      encrypted entries, one after another.
+//	index     12 byte nonce + AES-GCM sealed JSON table of contents.
+//	footer    24 bytes: index offset (8), index length (8), magic (8)
+//
+// All integers are little endian.
+// Positions in the table (StartPos, EndPos) are absolute offsets in the file.
+//
+// The index is sealed with the preamble and the header as associated data,
+// so a change of the plain header (mode, KDF, salt, key slots, ID) is found when the index is opened.
+// Every entry is encrypted with its own subkey (see EntryKey).
+const (
+	// FormatVersion is the container version this package can read and write.
+	// The files with another version are refused with ErrUnsupportedVersion.
+	FormatVersion uint16 = 1
+
+	preambleSize = 16
+	footerSize   = 24
+)
+
+// magic is written at the beginning and at the end of a container file.
+var magic = []byte("\x89PAKET\r\n")
+
+var (
+	// ErrInvalidFormat is returned when the file is not a paket container.
+	ErrInvalidFormat = errors.New("not a paket container file")
+
+	// ErrUnsupportedVersion is returned for container files with another format version, written by a newer version of paket.
+	ErrUnsupportedVersion = errors.New("unsupported paket format version")
+
+	// ErrInvalidKey is returned when the index of a container cannot be decrypted.
+	// Usually the key is wrong, rarely the index is damaged.
+	ErrInvalidKey = errors.New("invalid key or damaged index")
+)
+
+// Header is the plain part of a container file.
+// It keeps everything needed to derive the key again.
+type Header struct {
+	// format version of the file. It is not part of the JSON, it comes from the preamble.
+	Version uint16 `json:"-"`
+
+	// encrypt/decrypt mode of the entries.
+	Mode MODE `json:"mode"`
+
+	// key derivation function and its cost parameters.
+	KDF KDF `json:"kdf"`
+
+	// random salt for the KDF.
+	Salt []byte `json:"salt"`
+
+	// key slots that keep the data key, wrapped with different keys (see KeySlot).
+	// If there are slots, KDF and Salt are not used.
+	Slots []KeySlot `json:"slots,omitempty"`
+
+	// random ID of the paket, a part of the associated data of the entries (see AssociatedData)
+	// and the salt of their subkeys (see EntryKey).
+	ID []byte `json:"id"`
+}
+
+// index is the table of contents at the end of a container.
+// It is sealed with AES-GCM before writing.
+type index struct {
+	Entries Datas `json:"entries"`
+
+	// Ed25519 public key and signature of the manifest (see Sign). Empty if the paket is not signed.
+	// A change of the entries removes the signature, because it is not valid anymore.
+	Signer    []byte `json:"signer,omitempty"`
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// encodeHeader returns the preamble and the JSON header.
+func encodeHeader(h Header) ([]byte, error) {
+	js, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, preambleSize, preambleSize+len(js))
+	copy(buf, magic)
+	binary.LittleEndian.PutUint16(buf[8:], FormatVersion)
+	binary.LittleEndian.PutUint32(buf[12:], uint32(len(js)))
+	return append(buf, js...), nil
+}
+
+// readHeader reads the preamble and the header of a container.
+// Second value is the position where the entry data starts.
+func readHeader(r io.ReaderAt, size int64) (Header, int64, error) {
+	var h Header
+	if size < preambleSize+footerSize {
+		return h, 0, ErrInvalidFormat
+	}
+	pre := make([]byte, preambleSize)
+	if _, err := r.ReadAt(pre, 0); err != nil {
+		return h, 0, err
+	}
+	if !bytes.Equal(pre[:8], magic) {
+		return h, 0, ErrInvalidFormat
+	}
+	h.Version = binary.LittleEndian.Uint16(pre[8:])
+	if h.Version != FormatVersion {
+		return h, 0, ErrUnsupportedVersion
+	}
+	hLen := int64(binary.LittleEndian.Uint32(pre[12:]))
+	if preambleSize+hLen+footerSize > size {
+		return h, 0, ErrShortData
+	}
+	js := make([]byte, hLen)
+	if _, err := r.ReadAt(js, preambleSize); err != nil {
+		return h, 0, err
+	}
+	version := h.Version
+	if err := json.Unmarshal(js, &h); err != nil {
+		return h, 0, err
+	}
+	h.Version = version
+	return h, preambleSize + hLen, nil
+}
+
+// sealIndex encrypts the table with AES-GCM and appends the footer.
+// head is the preamble and the header of the file, exactly as they are written. It is the associated data of the index.
+// offset is the position where the index will be written.
+func sealIndex(key, head []byte, idx index, offset int64) ([]byte, error) {
+	js, err := json.Marshal(idx)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := CreateRandomBytes(16)
+	if err != nil {
+		return nil, err
+	}
+	nonce = nonce[:12]
+	sealed, err := EncryptWithAD(key, nonce, js, head, MODEGCM)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 0, len(nonce)+len(sealed)+footerSize)
+	buf = append(buf, nonce...)
+	buf = append(buf, sealed...)
+
+	footer := make([]byte, footerSize)
+	binary.LittleEndian.PutUint64(footer[0:], uint64(offset))
+	binary.LittleEndian.PutUint64(footer[8:], uint64(len(nonce)+len(sealed)))
+	copy(footer[16:], magic)
+	return append(buf, footer...), nil
+}
+
+// readFooter returns the position and the length of the index.
+func readFooter(r io.ReaderAt, size, dataStart int64) (int64, int64, error) {
+	footer := make([]byte, footerSize)
+	if _, err := r.ReadAt(footer, size-footerSize); err != nil {
+		return 0, 0, err
+	}
+	if !bytes.Equal(footer[16:], magic) {
+		return 0, 0, ErrInvalidFormat
+	}
+	offset := int64(binary.LittleEndian.Uint64(footer[0:]))
+	length := int64(binary.LittleEndian.Uint64(footer[8:]))
+	if offset < dataStart || length < 12+16 || offset+length > size-footerSize {
+		return 0, 0, ErrInvalidFormat
+	}
+	return offset, length, nil
+}
+
+// readHead returns the preamble and the header of a container, dataStart bytes from the beginning.
+func readHead(r io.ReaderAt, dataStart int64) ([]byte, error) {
+	head := make([]byte, dataStart)
+	if _, err := r.ReadAt(head, 0); err != nil {
+		return nil, err
+	}
+	return head, nil
+}
+
+// readIndex reads the footer and opens the index with the key.
+// dataStart is the end of the header, the index cannot start before it.
+// The header is read again for the associated data of the index.
+func readIndex(r io.ReaderAt, size, dataStart int64, key []byte) (index, error) {
+	offset, length, err := readFooter(r, size, dataStart)
+	if err != nil {
+		return index{}, err
+	}
+	head, err := readHead(r, dataStart)
+	if err != nil {
+		return index{}, err
+	}
+	sealed := make([]byte, length)
+	if _, err := r.ReadAt(sealed, offset); err != nil {
+		return index{}, err
+	}
+	js, err := DecryptWithAD(key, sealed[:12], sealed[12:], head, MODEGCM)
+	if err != nil {
+		return index{}, ErrInvalidKey
+	}
+	var idx index
+	if err := json.Unmarshal(js, &idx); err != nil {
+		return index{}, err
+	}
+	for name, v := range idx.Entries {
+		if v.EncryptLenght < 0 || v.OriginalLenght < 0 || v.CompressedLenght < 0 || v.ChunkSize < 0 ||
+			int64(v.StartPos) < dataStart || int64(v.EndPos) > offset || v.EndPos-v.StartPos != v.EncryptLenght {
+			return index{}, errors.New("invalid entry position in index: " + name)
+		}
+	}
+	return idx, nil
+}
+
+// tempFile is a new file written next to dst, that replaces dst when it is complete.
+// So dst is never left half written, and it is not changed if there is an error.
+type tempFile struct {
+	*os.File
+
+	dst string
+}
+
+// createTemp creates a tempFile for dst with the permissions perm.
+func createTemp(dst string, perm os.FileMode) (*tempFile, error) {
+	f, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	// CreateTemp creates the file only readable by the user.
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &tempFile{File: f, dst: dst}, nil
+}
+
+// commit syncs and closes the file and renames it to dst.
+// release is called before the rename (the old file must be closed on Windows), it can be nil.
+// The file is removed if there is an error.
+func (t *tempFile) commit(release func() error) error {
+	if err := t.Sync(); err != nil {
+		t.remove()
+		return err
+	}
+	if err := t.Close(); err != nil {
+		os.Remove(t.Name())
+		return err
+	}
+	if release != nil {
+		release()
+	}
+	if err := os.Rename(t.Name(), t.dst); err != nil {
+		os.Remove(t.Name())
+		return err
+	}
+	return nil
+}
+
+// remove closes and removes the file, dst is not changed.
+func (t *tempFile) remove() {
+	t.Close()
+	os.Remove(t.Name())
+}
+
+// replaceFile writes a new file with write and renames it to dst (see tempFile).
+// The new file has the permissions perm. release is called before the rename, it can be nil.
+func replaceFile(dst string, perm os.FileMode, write func(tmp *os.File) error, release func() error) error {
+	tmp, err := createTemp(dst, perm)
+	if err != nil {
+		return err
+	}
+	if err := write(tmp.File); err != nil {
+		tmp.remove()
+		return err
+	}
+	return tmp.commit(release)
+}
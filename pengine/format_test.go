@@ -0,0 +1,202 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+)
+
+// rewriteTestIndex opens the index of the container at path with the key "test key",
+// lets change modify the header and the index, and writes the file again with the index sealed for the new header.
+// The new header must have the same length as the old one.
+func rewriteTestIndex(t *testing.T, path string, change func(h *Header, idx *index)) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(data)
+	h, dataStart, err := readHeader(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := Option{Key: []byte("test key")}.containerKey(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := readIndex(r, r.Size(), dataStart, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset, _, err := readFooter(r, r.Size(), dataStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	change(&h, &idx)
+	head, err := encodeHeader(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(head)) != dataStart {
+		t.Fatal("the length of the header is changed")
+	}
+	tail, err := sealIndex(key, head, idx, offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := append(head, data[dataStart:offset]...)
+	if err := os.WriteFile(path, append(out, tail...), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// changeTestHeader changes the header of the container at path, without sealing the index again.
+func changeTestHeader(t *testing.T, path string, change func(h *Header)) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, dataStart, err := readHeader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	change(&h)
+	head, err := encodeHeader(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(head)) != dataStart {
+		t.Fatal("the length of the header is changed")
+	}
+	copy(data, head)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHeaderChanged(t *testing.T) {
+	changes := map[string]func(h *Header){
+		"mode": func(h *Header) { h.Mode = MODECTR },
+		"id":   func(h *Header) { h.ID[0] ^= 1 },
+		"kdf":  func(h *Header) { h.KDF.Iteration = 4095 },
+	}
+	for name, change := range changes {
+		path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM}, testFiles)
+		changeTestHeader(t, path, change)
+		_, err := New(Option{Key: []byte("test key"), PaketFile: path})
+		if !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("%s: New returned %v, want ErrInvalidKey", name, err)
+		}
+	}
+}
+
+func TestIndexChanged(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM}, testFiles)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed := append([]byte(nil), data...)
+	sealed[len(sealed)-footerSize-1] ^= 1
+	if err := os.WriteFile(path, sealed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Option{Key: []byte("test key"), PaketFile: path}); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("changed index: New returned %v, want ErrInvalidKey", err)
+	}
+
+	footer := append([]byte(nil), data...)
+	footer[len(footer)-1] ^= 1
+	if err := os.WriteFile(path, footer, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Option{Key: []byte("test key"), PaketFile: path}); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("changed footer: New returned %v, want ErrInvalidFormat", err)
+	}
+}
+
+func TestIndexInvalidLength(t *testing.T) {
+	changes := map[string]func(v *Values){
+		"encrypt":  func(v *Values) { v.EncryptLenght = -1; v.EndPos = v.StartPos - 1 },
+		"original": func(v *Values) { v.OriginalLenght = -1 },
+		"position": func(v *Values) { v.EndPos++ },
+	}
+	for name, change := range changes {
+		path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM}, testFiles)
+		rewriteTestIndex(t, path, func(h *Header, idx *index) {
+			v := idx.Entries["readme.txt"]
+			change(&v)
+			idx.Entries["readme.txt"] = v
+		})
+		if _, err := New(Option{Key: []byte("test key"), PaketFile: path}); err == nil {
+			t.Errorf("%s: invalid entry accepted", name)
+		}
+	}
+}
+
+func TestUnsupportedVersion(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM}, testFiles)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []uint16{0, FormatVersion + 1} {
+		binary.LittleEndian.PutUint16(data[8:], version)
+		if _, err := NewFromBytes(data, Option{Key: []byte("test key")}); !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("version %d: %v, want ErrUnsupportedVersion", version, err)
+		}
+	}
+}
+
+func TestKDFLimits(t *testing.T) {
+	kdfs := []KDF{
+		{Algorithm: KDFSCRYPT, N: 1 << 30, R: 8, P: 1},
+		{Algorithm: KDFARGON2ID, Time: 1, Memory: 1 << 31, Threads: 1},
+	}
+	for _, k := range kdfs {
+		if _, err := k.Key([]byte("test key"), []byte("salt")); !errors.Is(err, ErrInvalidKDF) {
+			t.Errorf("%v: Key returned %v, want ErrInvalidKDF", k, err)
+		}
+	}
+}
+
+// the PBKDF2 iteration is only limited for the KDFs read from a file, not for the legacy pakets.
+func TestPBKDF2Limit(t *testing.T) {
+	large := KDF{Algorithm: KDFPBKDF2, Iteration: maxPBKDF2Iteration + 1}
+	if err := large.checkStored(); !errors.Is(err, ErrInvalidKDF) {
+		t.Errorf("checkStored: %v, want ErrInvalidKDF", err)
+	}
+	if err := (KDF{Algorithm: KDFPBKDF2, Iteration: maxPBKDF2Iteration}).checkStored(); err != nil {
+		t.Errorf("checkStored of the maximum: %v", err)
+	}
+	if got := (Option{Iteration: maxPBKDF2Iteration + 1}).legacyKDF(); got != large {
+		t.Errorf("legacy KDF: %v", got)
+	}
+
+	if _, err := NewWriter(&bytes.Buffer{}, WriterOption{Key: []byte("test key"), Mode: MODEGCM, KDF: large}); !errors.Is(err, ErrInvalidKDF) {
+		t.Errorf("NewWriter: %v, want ErrInvalidKDF", err)
+	}
+	if _, err := NewWriter(&bytes.Buffer{}, WriterOption{Key: []byte("test key"), Mode: MODEGCM, KDF: large, Envelope: true}); !errors.Is(err, ErrInvalidKDF) {
+		t.Errorf("NewWriter with a key slot: %v, want ErrInvalidKDF", err)
+	}
+
+	// a header changed to a large iteration is refused before the key is derived.
+	head, err := encodeHeader(Header{Version: FormatVersion, Mode: MODEGCM, KDF: large, Salt: testRandom(32), ID: testRandom(16)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append(head, make([]byte, footerSize)...)
+	if _, err := NewFromBytes(data, Option{Key: []byte("test key")}); !errors.Is(err, ErrInvalidKDF) {
+		t.Errorf("New: %v, want ErrInvalidKDF", err)
+	}
+}
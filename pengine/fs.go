@@ -0,0 +1,233 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Paket can be used anywhere an fs.FS is accepted (html/template.ParseFS, http.FS, fs.WalkDir...).
+//
+// Names in the table are used as slash-separated paths. Directories are not stored,
+// they are created from the names. For example "ui/button.png" creates the "ui" directory.
+// Names that are not valid fs paths (see fs.ValidPath) cannot be reached with these methods, use GetFile for them.
+var (
+	_ fs.FS         = (*Paket)(nil)
+	_ fs.ReadFileFS = (*Paket)(nil)
+	_ fs.StatFS     = (*Paket)(nil)
+	_ fs.ReadDirFS  = (*Paket)(nil)
+)
+
+// Open opens the named file or directory for reading.
+//
+// For files, the returned value is a *File (see OpenFile). It is decrypted while reading,
+// and it can be used as an io.ReadSeekCloser.
+func (p *Paket) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if err := p.rlock(); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	_, found := p.table[name]
+	var entries []fs.DirEntry
+	var err error
+	if !found {
+		entries, err = p.readDir(name)
+	}
+	p.mu.RUnlock()
+	if found {
+		return p.OpenFile(name)
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &dir{info: fileInfo{name: path.Base(name), dir: true}, entries: entries}, nil
+}
+
+// ReadFile decrypts the named file and returns its content.
+// The original hash is always checked.
+func (p *Paket) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	if err := p.rlock(); err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	_, found := p.table[name]
+	p.mu.RUnlock()
+	if !found {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	data, ok, err := p.GetFile(name, true, true)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: ErrHashMismatch}
+	}
+	return data, nil
+}
+
+// Stat returns the information of the named file or directory.
+// Sys of the returned value is the Values of the file in the table (nil for directories).
+func (p *Paket) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if err := p.rlock(); err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	defer p.mu.RUnlock()
+	if v, found := p.table[name]; found {
+		return fileInfo{name: path.Base(name), v: v}, nil
+	}
+	if !p.isDir(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return fileInfo{name: path.Base(name), dir: true}, nil
+}
+
+// ReadDir returns the entries of the named directory, sorted by name.
+// "." is the root of the paket.
+func (p *Paket) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	if err := p.rlock(); err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	defer p.mu.RUnlock()
+	return p.readDir(name)
+}
+
+// readDir is ReadDir for a valid name. The read lock must be held.
+func (p *Paket) readDir(name string) ([]fs.DirEntry, error) {
+	if _, found := p.table[name]; found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	children := make(map[string]fileInfo)
+	for key, v := range p.table {
+		if !fs.ValidPath(key) {
+			continue
+		}
+		rest := key
+		if name != "." {
+			if !strings.HasPrefix(key, name+"/") {
+				continue
+			}
+			rest = key[len(name)+1:]
+		}
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			children[rest[:i]] = fileInfo{name: rest[:i], dir: true}
+		} else {
+			children[rest] = fileInfo{name: rest, v: v}
+		}
+	}
+	if len(children) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, info := range children {
+		entries = append(entries, info)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// isDir reports whether any name in the table is under the directory. The read lock must be held.
+func (p *Paket) isDir(name string) bool {
+	if name == "." {
+		return true
+	}
+	for key := range p.table {
+		if strings.HasPrefix(key, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// fileInfo is both fs.FileInfo and fs.DirEntry for the files and directories in Paket.
+type fileInfo struct {
+	name string
+	v    Values
+	dir  bool
+}
+
+func (fi fileInfo) Name() string { return fi.name }
+
+// Size is the length of the original file.
+func (fi fileInfo) Size() int64 {
+	if fi.dir {
+		return 0
+	}
+	return int64(fi.v.OriginalLenght)
+}
+
+func (fi fileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// ModTime is not kept in the table.
+func (fi fileInfo) ModTime() time.Time { return time.Time{} }
+
+func (fi fileInfo) IsDir() bool { return fi.dir }
+
+// Sys returns the Values of the file in the table. It is nil for directories.
+func (fi fileInfo) Sys() interface{} {
+	if fi.dir {
+		return nil
+	}
+	return fi.v
+}
+
+func (fi fileInfo) Type() fs.FileMode { return fi.Mode().Type() }
+
+func (fi fileInfo) Info() (fs.FileInfo, error) { return fi, nil }
+
+// dir is a directory returned by Open.
+type dir struct {
+	info    fileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) Close() error { return nil }
+
+// ReadDir works like os.File.ReadDir.
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"errors"
+	"io/fs"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	// fstest reads in small pieces, every ReadAt decrypts a whole chunk.
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM, ChunkSize: 1024}, testFiles)
+	p := openTestPaket(t, path)
+	if err := fstest.TestFS(p, "readme.txt", "ui/index.html", "ui/img/logo.bin", "sounds/click.wav", "empty"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFSAfterClose(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM}, testFiles)
+	p := openTestPaket(t, path)
+	p.Close()
+
+	if _, err := p.Open("readme.txt"); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("Open: %v", err)
+	}
+	if _, err := p.ReadFile("readme.txt"); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("ReadFile: %v", err)
+	}
+	if _, err := p.Stat("ui"); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("Stat: %v", err)
+	}
+	if _, err := p.ReadDir("."); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("ReadDir: %v", err)
+	}
+}
+
+// TestCloseWhileReading is meant for go test -race: the reads must not race with Close.
+func TestCloseWhileReading(t *testing.T) {
+	for _, mmap := range []bool{false, true} {
+		path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODECTR}, testFiles)
+		p, err := New(Option{Key: []byte("test key"), PaketFile: path, Mmap: mmap, CacheSize: 1 << 20})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					for name := range testFiles {
+						if _, _, err := p.GetFile(name, true, true); err != nil && !errors.Is(err, fs.ErrClosed) {
+							t.Error(err)
+						}
+						if _, err := p.ReadFile(name); err != nil && !errors.Is(err, fs.ErrClosed) {
+							t.Error(err)
+						}
+						if _, err := p.Stat(name); err != nil && !errors.Is(err, fs.ErrClosed) {
+							t.Error(err)
+						}
+						if _, err := p.ReadDir("ui"); err != nil && !errors.Is(err, fs.ErrClosed) {
+							t.Error(err)
+						}
+						if f, err := p.Open(name); err == nil {
+							buf := make([]byte, 100)
+							f.Read(buf)
+							f.Close()
+						} else if !errors.Is(err, fs.ErrClosed) {
+							t.Error(err)
+						}
+					}
+				}
+			}()
+		}
+		p.Close()
+		wg.Wait()
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrInvalidKDF is returned for an unknown KDF or invalid KDF parameters.
+var ErrInvalidKDF = errors.New("invalid KDF or KDF parameters")
+
+// maxKDFMemory is the maximum memory a KDF can ask for (4 GiB).
+// The parameters are read from the header of a file, a changed header must not be able to exhaust the memory.
+const maxKDFMemory = 1 << 32
+
+// maxPBKDF2Iteration is the maximum PBKDF2 iteration (about 16 million) of a container header or a key slot,
+// for the same reason: a changed header must not be able to keep the reader busy for hours.
+// It is checked by checkStored, not by Key: the iteration of a legacy paket comes from the program, not from the file.
+const maxPBKDF2Iteration = 1 << 24
+
+// KDF keeps the key derivation function and its cost parameters.
+// It is written to the header of container files, so the reader does not need to know it.
+//
+// Only the fields of the selected Algorithm are used.
+// The zero value is PBKDF2 with 4096 iterations.
+type KDF struct {
+	Algorithm KDFMODE `json:"algorithm"`
+
+	// PBKDF2 (sha256) iteration. For less than 4096, 4096 is used.
+	// A container or a key slot cannot have more than 1 << 24, ErrInvalidKDF is returned for it.
+	Iteration uint `json:"iteration,omitempty"`
+
+	// scrypt parameters: CPU/memory cost (power of two), block size and parallelization.
+	N int `json:"n,omitempty"`
+	R int `json:"r,omitempty"`
+	P int `json:"p,omitempty"`
+
+	// Argon2id parameters: number of passes, memory in KiB and threads.
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"`
+	Threads uint8  `json:"threads,omitempty"`
+}
+
+// DefaultKDF returns the KDF with the default cost parameters for the algorithm.
+//
+// These values are a starting point. You should do tests for the devices you are targeting.
+func DefaultKDF(algorithm KDFMODE) (KDF, error) {
+	switch algorithm {
+	case KDFPBKDF2:
+		return KDF{Algorithm: KDFPBKDF2, Iteration: 4096}, nil
+	case KDFSCRYPT:
+		return KDF{Algorithm: KDFSCRYPT, N: 1 << 15, R: 8, P: 1}, nil
+	case KDFARGON2ID:
+		return KDF{Algorithm: KDFARGON2ID, Time: 3, Memory: 64 * 1024, Threads: 4}, nil
+	default:
+		return KDF{}, ErrInvalidKDF
+	}
+}
+
+// Key derives a 32 byte key from the password and the salt.
+func (k KDF) Key(password, salt []byte) ([]byte, error) {
+	switch k.Algorithm {
+	case 0, KDFPBKDF2:
+		iteration := k.Iteration
+		if iteration < 4096 {
+			iteration = 4096
+		}
+		return pbkdf2.Key(password, salt, int(iteration), 32, sha256.New), nil
+
+	case KDFSCRYPT:
+		if k.N <= 1 || k.N&(k.N-1) != 0 || k.R < 1 || k.P < 1 || uint64(k.N)*uint64(k.R)*128 > maxKDFMemory {
+			return nil, ErrInvalidKDF
+		}
+		return scrypt.Key(password, salt, k.N, k.R, k.P, 32)
+
+	case KDFARGON2ID:
+		if k.Time < 1 || k.Threads < 1 || k.Memory < 8*uint32(k.Threads) || uint64(k.Memory)*1024 > maxKDFMemory {
+			return nil, ErrInvalidKDF
+		}
+		return argon2.IDKey(password, salt, k.Time, k.Memory, k.Threads, 32), nil
+
+	case KDFPIPELINE:
+		return nil, ErrPipelineRequired
+
+	case KDFRAW:
+		if len(password) != 32 {
+			return nil, errors.New("raw key must be 32 bytes")
+		}
+		return append([]byte(nil), password...), nil
+
+	case KDFX25519:
+		return nil, ErrIdentityRequired
+
+	default:
+		return nil, ErrInvalidKDF
+	}
+}
+
+// checkStored returns ErrInvalidKDF for the parameters that cannot be written to a container header or a key slot.
+// The other parameters are checked by Key.
+func (k KDF) checkStored() error {
+	if (k.Algorithm == 0 || k.Algorithm == KDFPBKDF2) && k.Iteration > maxPBKDF2Iteration {
+		return ErrInvalidKDF
+	}
+	return nil
+}
+
+// String returns the KDF in the format of ParseKDF.
+func (k KDF) String() string {
+	switch k.Algorithm {
+	case 0, KDFPBKDF2:
+		iteration := k.Iteration
+		if iteration < 4096 {
+			iteration = 4096
+		}
+		return fmt.Sprintf("pbkdf2:i=%d", iteration)
+	case KDFSCRYPT:
+		return fmt.Sprintf("scrypt:n=%d,r=%d,p=%d", k.N, k.R, k.P)
+	case KDFARGON2ID:
+		return fmt.Sprintf("argon2id:t=%d,m=%d,p=%d", k.Time, k.Memory, k.Threads)
+	case KDFPIPELINE:
+		return "pipeline"
+	case KDFRAW:
+		return "raw"
+	case KDFX25519:
+		return "x25519"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseKDF parses a KDF written as "name" or "name:param=value,param=value". (for cmd tool)
+//
+// Missing parameters are taken from DefaultKDF. Examples:
+//
+//	pbkdf2:i=100000
+//	scrypt:n=32768,r=8,p=1
+//	argon2id:t=3,m=65536,p=4 (m is in KiB)
+//	raw (a 32 byte key, not derived)
+func ParseKDF(s string) (KDF, error) {
+	name, params := s, ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		name, params = s[:i], s[i+1:]
+	}
+
+	var k KDF
+	var err error
+	switch strings.ToLower(name) {
+	case "pbkdf2":
+		k, err = DefaultKDF(KDFPBKDF2)
+	case "scrypt":
+		k, err = DefaultKDF(KDFSCRYPT)
+	case "argon2id", "argon2":
+		k, err = DefaultKDF(KDFARGON2ID)
+	case "raw":
+		if params != "" {
+			return KDF{}, errors.New("raw key has no parameters")
+		}
+		return KDF{Algorithm: KDFRAW}, nil
+	default:
+		return KDF{}, errors.New("unknown KDF: " + name)
+	}
+	if err != nil || params == "" {
+		return k, err
+	}
+
+	for _, param := range strings.Split(params, ",") {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return KDF{}, errors.New("invalid KDF parameter: " + param)
+		}
+		value, err := strconv.ParseUint(kv[1], 10, 32)
+		if err != nil {
+			return KDF{}, errors.New("invalid KDF parameter: " + param)
+		}
+		switch k.Algorithm {
+		case KDFPBKDF2:
+			switch kv[0] {
+			case "i":
+				k.Iteration = uint(value)
+			default:
+				return KDF{}, errors.New("unknown pbkdf2 parameter: " + kv[0])
+			}
+		case KDFSCRYPT:
+			switch kv[0] {
+			case "n":
+				k.N = int(value)
+			case "r":
+				k.R = int(value)
+			case "p":
+				k.P = int(value)
+			default:
+				return KDF{}, errors.New("unknown scrypt parameter: " + kv[0])
+			}
+		case KDFARGON2ID:
+			switch kv[0] {
+			case "t":
+				k.Time = uint32(value)
+			case "m":
+				k.Memory = uint32(value)
+			case "p":
+				if value > 255 {
+					return KDF{}, errors.New("invalid KDF parameter: " + param)
+				}
+				k.Threads = uint8(value)
+			default:
+				return KDF{}, errors.New("unknown argon2id parameter: " + kv[0])
+			}
+		}
+	}
+	return k, nil
+}
@@ -0,0 +1,107 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseKDF(t *testing.T) {
+	valid := map[string]KDF{
+		"pbkdf2":                  {Algorithm: KDFPBKDF2, Iteration: 4096},
+		"PBKDF2:i=100000":         {Algorithm: KDFPBKDF2, Iteration: 100000},
+		"scrypt":                  {Algorithm: KDFSCRYPT, N: 1 << 15, R: 8, P: 1},
+		"scrypt:n=1024,p=2":       {Algorithm: KDFSCRYPT, N: 1024, R: 8, P: 2},
+		"argon2id:t=1,m=1024,p=2": {Algorithm: KDFARGON2ID, Time: 1, Memory: 1024, Threads: 2},
+		"argon2":                  {Algorithm: KDFARGON2ID, Time: 3, Memory: 64 * 1024, Threads: 4},
+		"raw":                     {Algorithm: KDFRAW},
+	}
+	for s, want := range valid {
+		got, err := ParseKDF(s)
+		if err != nil || got != want {
+			t.Errorf("%q: %+v, %v; want %+v", s, got, err, want)
+		}
+	}
+
+	for _, s := range []string{"", "bcrypt", "pbkdf2:n=10", "scrypt:n", "scrypt:n=-1", "argon2id:p=256", "argon2id:t=x", "raw:i=1", "pbkdf2:i=4096,"} {
+		if k, err := ParseKDF(s); err == nil {
+			t.Errorf("%q is accepted: %+v", s, k)
+		}
+	}
+}
+
+func TestKDFKey(t *testing.T) {
+	kdfs := []KDF{
+		{Algorithm: KDFPBKDF2, Iteration: 4096},
+		{Algorithm: KDFSCRYPT, N: 1 << 10, R: 8, P: 1},
+		{Algorithm: KDFARGON2ID, Time: 1, Memory: 1024, Threads: 1},
+	}
+	var keys [][]byte
+	for _, k := range kdfs {
+		key, err := k.Key([]byte("test key"), []byte("salt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(key) != 32 {
+			t.Fatalf("%+v: key length %d", k, len(key))
+		}
+		again, _ := k.Key([]byte("test key"), []byte("salt"))
+		other, _ := k.Key([]byte("test key"), []byte("other salt"))
+		if !bytes.Equal(key, again) || bytes.Equal(key, other) {
+			t.Errorf("%+v: the key does not depend only on the password and the salt", k)
+		}
+		for _, prev := range keys {
+			if bytes.Equal(prev, key) {
+				t.Errorf("%+v: the same key as another KDF", k)
+			}
+		}
+		keys = append(keys, key)
+	}
+
+	// the zero value and the small iterations are PBKDF2 with 4096 iterations.
+	for _, k := range []KDF{{}, {Algorithm: KDFPBKDF2, Iteration: 10}} {
+		if key, _ := k.Key([]byte("test key"), []byte("salt")); !bytes.Equal(key, keys[0]) {
+			t.Errorf("%+v is not PBKDF2 with 4096 iterations", k)
+		}
+	}
+
+	invalid := []KDF{
+		{Algorithm: KDFSCRYPT, N: 1000, R: 8, P: 1},
+		{Algorithm: KDFSCRYPT, N: 1024, R: 0, P: 1},
+		{Algorithm: KDFARGON2ID, Time: 0, Memory: 1024, Threads: 1},
+		{Algorithm: KDFARGON2ID, Time: 1, Memory: 4, Threads: 1},
+		{Algorithm: 100},
+	}
+	for _, k := range invalid {
+		if _, err := k.Key([]byte("test key"), []byte("salt")); err == nil {
+			t.Errorf("%+v is accepted", k)
+		}
+	}
+}
+
+// the KDF is read from the header, the reader does not give it.
+func TestKDFStored(t *testing.T) {
+	kdfs := []KDF{
+		{Algorithm: KDFSCRYPT, N: 1 << 10, R: 8, P: 1},
+		{Algorithm: KDFARGON2ID, Time: 1, Memory: 1024, Threads: 1},
+	}
+	for _, k := range kdfs {
+		for _, envelope := range []bool{false, true} {
+			path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM, KDF: k, Envelope: envelope}, testFiles)
+			checkTestFiles(t, openTestPaket(t, path))
+			if envelope {
+				infos, err := KeySlots(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if infos[0].KDF != k {
+					t.Errorf("KDF of the slot: %+v, want %+v", infos[0].KDF, k)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrRootMismatch is returned when the Merkle root of a paket is not the expected root.
+// An entry was added, removed, renamed, moved or changed.
+var ErrRootMismatch = errors.New("merkle root of the paket does not match")
+
+// MerkleProof is the inclusion proof of one entry: the hashes of its siblings from the leaf to the root.
+// With the proof, one entry can be checked against the root without the table of the other entries.
+type MerkleProof struct {
+	// position of the entry in the entries sorted by name, and the number of entries.
+	Index int
+	Count int
+
+	// sibling hashes from the leaf to the root. A level without a sibling has no hash.
+	Path [][]byte
+}
+
+// merkleLeaf returns the leaf hash of an entry: its name, its position relative to the start of the data
+// and every table value that is used to read it (lengths, hashes, nonce, chunk size, compression, associated data).
+// The positions are relative, so the root does not change with the header (see AddKeySlot).
+func merkleLeaf(name string, v Values, dataStart int64) []byte {
+	h := sha256.New()
+	var num [8]byte
+	writeNum := func(n int64) {
+		binary.LittleEndian.PutUint64(num[:], uint64(n))
+		h.Write(num[:])
+	}
+	// variable length values are written with their length, so two values cannot be shifted into each other.
+	writeBytes := func(b []byte) {
+		writeNum(int64(len(b)))
+		h.Write(b)
+	}
+	h.Write([]byte{0})
+	writeBytes([]byte(name))
+	writeNum(int64(v.StartPos) - dataStart)
+	writeNum(int64(v.EndPos) - dataStart)
+	writeNum(int64(v.OriginalLenght))
+	writeNum(int64(v.EncryptLenght))
+	writeNum(int64(v.CompressedLenght))
+	writeNum(int64(v.ChunkSize))
+	writeNum(int64(v.Compression))
+	if v.AAD {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+	writeBytes(v.Nonce)
+	writeBytes(v.HashOriginal)
+	writeBytes(v.HashEncrypt)
+	return h.Sum(nil)
+}
+
+// merkleNode returns the hash of two child nodes. Leaves and nodes have different prefixes, so a node cannot be shown as a leaf.
+func merkleNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// merkleLeaves returns the sorted names of the table and their leaf hashes.
+func merkleLeaves(table Datas, dataStart int64) ([]string, [][]byte) {
+	names := make([]string, 0, len(table))
+	for name := range table {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	leaves := make([][]byte, len(names))
+	for i, name := range names {
+		leaves[i] = merkleLeaf(name, table[name], dataStart)
+	}
+	return names, leaves
+}
+
+// merkleLevels returns all levels of the tree, from the leaves to the root.
+// The last node of a level with an odd count is moved up without hashing.
+func merkleLevels(leaves [][]byte) [][][]byte {
+	levels := [][][]byte{leaves}
+	for level := leaves; len(level) > 1; {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+			} else {
+				next = append(next, merkleNode(level[i], level[i+1]))
+			}
+		}
+		levels = append(levels, next)
+		level = next
+	}
+	return levels
+}
+
+// merkleRoot returns the root of the table. The root of an empty table is the hash of nothing.
+func merkleRoot(table Datas, dataStart int64) []byte {
+	_, leaves := merkleLeaves(table, dataStart)
+	if len(leaves) == 0 {
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	}
+	levels := merkleLevels(leaves)
+	return levels[len(levels)-1][0]
+}
+
+// VerifyMerkleProof reports whether the leaf hash is in the tree with the root.
+// The leaf hash of an entry is returned by Paket.MerkleLeaf.
+func VerifyMerkleProof(root, leaf []byte, proof MerkleProof) bool {
+	if proof.Index < 0 || proof.Index >= proof.Count {
+		return false
+	}
+	hash, index, count, path := leaf, proof.Index, proof.Count, proof.Path
+	for count > 1 {
+		if index^1 < count {
+			if len(path) == 0 {
+				return false
+			}
+			if index%2 == 0 {
+				hash = merkleNode(hash, path[0])
+			} else {
+				hash = merkleNode(path[0], hash)
+			}
+			path = path[1:]
+		}
+		index /= 2
+		count = (count + 1) / 2
+	}
+	return len(path) == 0 && bytes.Equal(hash, root)
+}
+
+// MerkleRoot returns the Merkle root of the paket: one 32 byte hash of the names, the positions and the other table values of every entry.
+// Adding, removing, renaming, moving or changing any entry changes the root.
+//
+// A launcher can keep the root of each release and open the paket with Option.TrustedRoot,
+// or check the entries with VerifyEntry and VerifyAll.
+func (p *Paket) MerkleRoot() ([]byte, error) {
+	if err := p.rlock(); err != nil {
+		return nil, err
+	}
+	defer p.mu.RUnlock()
+	return merkleRoot(p.table, p.dataStart), nil
+}
+
+// MerkleLeaf returns the leaf hash of the entry, for VerifyMerkleProof.
+func (p *Paket) MerkleLeaf(name string) ([]byte, error) {
+	if err := p.rlock(); err != nil {
+		return nil, err
+	}
+	defer p.mu.RUnlock()
+	v, found := p.table[name]
+	if !found {
+		return nil, errors.New("File not found on map: " + name)
+	}
+	return merkleLeaf(name, v, p.dataStart), nil
+}
+
+// MerkleProof returns the inclusion proof of the entry.
+func (p *Paket) MerkleProof(name string) (MerkleProof, error) {
+	if err := p.rlock(); err != nil {
+		return MerkleProof{}, err
+	}
+	defer p.mu.RUnlock()
+	if _, found := p.table[name]; !found {
+		return MerkleProof{}, errors.New("File not found on map: " + name)
+	}
+	names, leaves := merkleLeaves(p.table, p.dataStart)
+	index := sort.SearchStrings(names, name)
+	proof := MerkleProof{Index: index, Count: len(leaves)}
+	for _, level := range merkleLevels(leaves) {
+		if index^1 < len(level) {
+			proof.Path = append(proof.Path, level[index^1])
+		}
+		index /= 2
+	}
+	return proof, nil
+}
+
+// VerifyEntry checks one entry against a trusted root: the inclusion proof of its table values,
+// and the hash of its encrypted data in the file. The entry is not decrypted.
+//
+// Returns ErrRootMismatch if the table values are not in the root, and ErrHashMismatch if the data is changed.
+func (p *Paket) VerifyEntry(root []byte, name string) error {
+	leaf, err := p.MerkleLeaf(name)
+	if err != nil {
+		return err
+	}
+	proof, err := p.MerkleProof(name)
+	if err != nil {
+		return err
+	}
+	if !VerifyMerkleProof(root, leaf, proof) {
+		return ErrRootMismatch
+	}
+	_, ok, err := p.GetFile(name, false, true)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrHashMismatch, name)
+	}
+	return nil
+}
+
+// VerifyAll checks the whole paket against a trusted root: the root of the table,
+// and the hash of the encrypted data of every entry. The entries are not decrypted.
+func (p *Paket) VerifyAll(root []byte) error {
+	actual, err := p.MerkleRoot()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(actual, root) {
+		return ErrRootMismatch
+	}
+	for _, name := range p.Names() {
+		if _, ok, err := p.GetFile(name, false, true); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("%w: %s", ErrHashMismatch, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+// corruptEntry flips a byte in the encrypted data of the entry.
+func corruptEntry(t *testing.T, path string, v Values) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, int64(v.EndPos-1)); err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 1
+	if _, err := f.WriteAt(b, int64(v.EndPos-1)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyHashMismatch(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODECTR}, testFiles)
+	p := openTestPaket(t, path)
+	root, err := p.MerkleRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.VerifyAll(root); err != nil {
+		t.Fatal(err)
+	}
+	corruptEntry(t, path, p.table["readme.txt"])
+	if err := p.VerifyEntry(root, "readme.txt"); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("VerifyEntry: %v", err)
+	}
+	if err := p.VerifyAll(root); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("VerifyAll: %v", err)
+	}
+}
+
+func TestMerkleRootCoversValues(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM, Compression: COMPRESSZSTD}, testFiles)
+	p := openTestPaket(t, path)
+	root := merkleRoot(p.table, p.dataStart)
+	changes := map[string]func(v *Values){
+		"OriginalLenght":   func(v *Values) { v.OriginalLenght-- },
+		"EncryptLenght":    func(v *Values) { v.EncryptLenght-- },
+		"CompressedLenght": func(v *Values) { v.CompressedLenght++ },
+		"HashOriginal":     func(v *Values) { v.HashOriginal = make([]byte, 32) },
+		"HashEncrypt":      func(v *Values) { v.HashEncrypt = make([]byte, 32) },
+		"Nonce":            func(v *Values) { v.Nonce = make([]byte, len(v.Nonce)) },
+		"ChunkSize":        func(v *Values) { v.ChunkSize++ },
+		"Compression":      func(v *Values) { v.Compression = COMPRESSNONE },
+		"AAD":              func(v *Values) { v.AAD = !v.AAD },
+		"StartPos":         func(v *Values) { v.StartPos++ },
+	}
+	for field, change := range changes {
+		table := make(Datas, len(p.table))
+		for name, v := range p.table {
+			table[name] = v
+		}
+		v := table["ui/index.html"]
+		change(&v)
+		table["ui/index.html"] = v
+		if bytes.Equal(merkleRoot(table, p.dataStart), root) {
+			t.Errorf("changing %s does not change the root", field)
+		}
+	}
+}
+
+func TestMerkleProof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		files := make(map[string][]byte)
+		for i := 0; i < n; i++ {
+			files[string(rune('a'+i))] = []byte{byte(i)}
+		}
+		path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM}, files)
+		p := openTestPaket(t, path)
+		root, _ := p.MerkleRoot()
+		for name := range files {
+			leaf, _ := p.MerkleLeaf(name)
+			proof, err := p.MerkleProof(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyMerkleProof(root, leaf, proof) {
+				t.Errorf("%d entries: proof of %s is not valid", n, name)
+			}
+			leaf[0] ^= 1
+			if VerifyMerkleProof(root, leaf, proof) {
+				t.Errorf("%d entries: changed leaf of %s is valid", n, name)
+			}
+		}
+	}
+}
+
+func TestTrustedRoot(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM}, testFiles)
+	root, err := openTestPaket(t, path).MerkleRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := New(Option{Key: []byte("test key"), PaketFile: path, TrustedRoot: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+	root[0] ^= 1
+	if _, err := New(Option{Key: []byte("test key"), PaketFile: path, TrustedRoot: root}); err != ErrRootMismatch {
+		t.Errorf("other root: %v", err)
+	}
+}
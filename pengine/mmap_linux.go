@@ -0,0 +1,32 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+//go:build linux
+// +build linux
+
+package pengine
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the file into memory, read only.
+// It returns nil for an empty file, an empty file cannot be mapped.
+func mmapFile(f *os.File, size int64) ([]byte, error) {
+	if size == 0 {
+		return nil, nil
+	}
+	if int64(int(size)) != size {
+		return nil, errors.New("file is too large to map")
+	}
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmap releases the mapping.
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
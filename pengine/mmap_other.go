@@ -0,0 +1,21 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+//go:build !linux
+// +build !linux
+
+package pengine
+
+import "os"
+
+// mmapFile is not supported on this system. It returns nil, the file is read with ReadAt as usual.
+func mmapFile(f *os.File, size int64) ([]byte, error) {
+	return nil, nil
+}
+
+// munmap does nothing, nothing is mapped on this system.
+func munmap(data []byte) error {
+	return nil
+}
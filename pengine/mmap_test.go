@@ -0,0 +1,64 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// on the systems without mmap, Option.Mmap reads the file as usual and the same results are expected.
+func TestMmap(t *testing.T) {
+	for _, mode := range testModes {
+		path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: mode, Compression: COMPRESSDEFLATE}, testFiles)
+		p, err := New(Option{Key: []byte("test key"), PaketFile: path, Mmap: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the second read checks that the mapped data is not changed by the first.
+		checkTestFiles(t, p)
+		checkTestFiles(t, p)
+		got, err := p.GetRange("ui/img/logo.bin", 100, 50)
+		if err != nil || !bytes.Equal(got, testFiles["ui/img/logo.bin"][100:150]) {
+			t.Fatalf("mode %d: GetRange: %v", mode, err)
+		}
+
+		if err := p.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := p.GetFile("readme.txt", true, true); !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("mode %d: GetFile after Close: %v, want fs.ErrClosed", mode, err)
+		}
+		if _, err := p.GetRange("readme.txt", 0, 1); !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("mode %d: GetRange after Close: %v, want fs.ErrClosed", mode, err)
+		}
+	}
+}
+
+func TestMmapLegacy(t *testing.T) {
+	o := writeTestLegacyPaket(t, MODECBC)
+	o.Mmap = true
+	p, err := New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	checkTestFiles(t, p)
+}
+
+func TestMmapEmptyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.pack")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Option{Key: []byte("test key"), PaketFile: path, Mmap: true}); err == nil {
+		t.Error("an empty file is opened as a container")
+	}
+}
@@ -3,15 +3,25 @@
 // You can find the license on the repo's main folder.
 // Provided without warranty of any kind.
 
-//Package pengine low-level APIs for paket.
+// Package pengine low-level APIs for paket.
 //
 // Before using it, you need to create a file with the cmd tool. (If you are not creating a new tool or API).
 //
 // Users do not need functions and structures other than New and Paket methods.
 //
-//Other exported functions and variables are for the cmd tool.
+// Other exported functions and variables are for the cmd tool.
 // If you only want to read the package created with the cmd tool,
 // you can create a new Paket method with New().
+//
+// The cmd tool writes a self-describing container file by default (see Writer).
+// The mode, salt and KDF parameters are stored in the file, so only the path and the key are needed to open it.
+// Files created with the legacy "Go table" flow are still supported by passing the table to New.
+//
+// A paket does not have to be a file on disk: NewFromReaderAt and NewFromBytes read it from any io.ReaderAt
+// or from memory, for example from a paket embedded in the program with go:embed.
+//
+// Paket is also an fs.FS (with fs.ReadFileFS, fs.StatFS and fs.ReadDirFS),
+// so it can be passed to html/template.ParseFS, http.FS, fs.WalkDir and similar APIs.
 package pengine
 
 import (
@@ -20,12 +30,13 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"io"
+	"io/fs"
 	"os"
+	"sort"
 	"sync"
-
-	"golang.org/x/crypto/pbkdf2"
 )
 
 var (
@@ -40,6 +51,16 @@ var (
 
 	//
 	ErrNotFound = errors.New("paket not found")
+
+	// ErrTruncated is returned when the paket data ends before the end of an entry.
+	// The table says more data than the file has, the file was probably cut while copying.
+	ErrTruncated = errors.New("paket data is truncated")
+
+	// ErrHashMismatch is returned when the hash of the decrypted data is not the same as the hash in the table.
+	ErrHashMismatch = errors.New("hash of the data does not match the table")
+
+	// ErrInvalidNonce is returned by the authenticated modes when the nonce is not NonceSize(mode) bytes.
+	ErrInvalidNonce = errors.New("invalid nonce length for the mode")
 )
 
 // type declaration for map values.
@@ -67,13 +88,31 @@ type Values struct {
 	// A guarantee that the encrypted data has not been changed.
 	HashEncrypt []byte
 
-	// for gcm mode
-	// nil can be write  if GCM is not used.
+	// for gcm, chacha20-poly1305 and xchacha20-poly1305 modes
+	// nil can be write  if these modes are not used.
 	//
 	// Usually nonce is added at the beginning of the first GCM block.
 	// It may be added as an option in a future release.
 	// It is currently being write to the table with the cmd tool.
 	Nonce []byte
+
+	// Size of the plain chunks for the authenticated modes.
+	// 0 means the entry is sealed as one block (legacy tables and old files).
+	// See DefaultChunkSize.
+	ChunkSize int `json:",omitempty"`
+
+	// compression of the data before encryption.
+	// GetFile decompresses the data, the hash of the original file is checked after decompression.
+	Compression COMPRESSION `json:",omitempty"`
+
+	// length of the compressed data. 0 if the entry is not compressed.
+	CompressedLenght int `json:",omitempty"`
+
+	// the entry is sealed with the associated data of AssociatedData: its name, the paket ID and the format version.
+	// Then the encrypted data of an entry cannot be moved to another entry or another paket.
+	// The entries of a container always have it. false for the entries of the legacy tables written before it,
+	// they are opened without associated data.
+	AAD bool `json:",omitempty"`
 }
 
 // type definition for the Paket.
@@ -86,9 +125,9 @@ type Values struct {
 type Datas map[string]Values
 
 // CreateRandomBytes generates random bytes of the given size.
-//The maximum value should be 32 and the minimum value should be 16.
+// The maximum value should be 32 and the minimum value should be 16.
 //
-//Used to generate a random key if the user has not specified a key. (for cmd tool)
+// Used to generate a random key if the user has not specified a key. (for cmd tool)
 //
 // Returns error for the wrong size or  creating bytes.
 func CreateRandomBytes(l uint8) ([]byte, error) {
@@ -105,29 +144,58 @@ func CreateRandomBytes(l uint8) ([]byte, error) {
 
 // Encrypt encrypts the data using the key.
 //
-// Key must be 16, 24 or 32 length.
+// Key must be 16, 24 or 32 length (32 for the ChaCha20 modes).
 // Otherwise, the cypher module returns an error.
 //
-// If the data is encrypted with GCM mode selected, you should pass  the nonce.
+// If the data is encrypted with GCM, ChaCha20-Poly1305 or XChaCha20-Poly1305 mode selected, you should pass  the nonce.
+// Its length must be NonceSize(mode).
 // For other modes it can be nonce nil.
 // Paket does not add the nonce to the beginning of the block.
 // Nonce is written to the table by the cmd tool.
 // If the package was created using the cmd tool with  selecting GCM,
 // nonce will be saved in   table.
 //
-// No authendication is provided in any mode except GCM mode.
+// No authendication is provided in any mode except GCM, ChaCha20-Poly1305, XChaCha20-Poly1305 and CBC mode.
 // You have to provide these implementations yourself.
 // paket  relies on hash generators for authendication.
 //
+// In CBC mode the data is padded with PKCS#7 and an HMAC-SHA256 of the IV and the encrypted data is added to the end.
+// So the output is IV + encrypted blocks + 32 bytes HMAC.
+//
 // You can compare the data sended  to the function with the output data.
 // It might be a good idea to make sure it's working properly.
 //
-//If everything is working correctly, it returns an encrypted bytes and nil error.
+// If everything is working correctly, it returns an encrypted bytes and nil error.
 func Encrypt(key, nonce, data []byte, mode MODE) ([]byte, error) {
+	return EncryptWithAD(key, nonce, data, nil, mode)
+}
+
+// EncryptWithAD is Encrypt with additional data for the authenticated modes (GCM, ChaCha20-Poly1305, XChaCha20-Poly1305).
+// The additional data is not encrypted and not written, but the same data must be given to DecryptWithAD.
+// It is not used by the other modes.
+// The nonce of the authenticated modes must be NonceSize(mode) bytes, otherwise ErrInvalidNonce is returned.
+//
+// Paket uses the name of the entry and the paket ID as additional data (see AssociatedData),
+// so the encrypted data of an entry cannot be given as the data of another entry.
+func EncryptWithAD(key, nonce, data, ad []byte, mode MODE) ([]byte, error) {
+	if isAEAD(mode) && len(nonce) != NonceSize(mode) {
+		return nil, ErrInvalidNonce
+	}
+	if mode == MODECHACHA20POLY1305 || mode == MODEXCHACHA20POLY1305 {
+		aead, err := newAEAD(key, mode)
+		if err != nil {
+			return nil, err
+		}
+		return aead.Seal(nil, nonce, data, ad), nil
+	}
+
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
+	if mode == MODECBC {
+		return sealCBC(block, key, data)
+	}
 	ciphertext := []byte{}
 	v := []byte{}
 	if mode != MODEGCM {
@@ -143,11 +211,6 @@ func Encrypt(key, nonce, data []byte, mode MODE) ([]byte, error) {
 	}
 
 	switch mode {
-	case MODECBC:
-		cbcMode := cipher.NewCBCEncrypter(block, v)
-		cbcMode.CryptBlocks(ciphertext[aes.BlockSize:], data)
-		return ciphertext, nil
-
 	case MODECFB:
 		s := cipher.NewCFBEncrypter(block, v)
 		s.XORKeyStream(ciphertext[aes.BlockSize:], data)
@@ -168,7 +231,7 @@ func Encrypt(key, nonce, data []byte, mode MODE) ([]byte, error) {
 		if err != nil {
 			return nil, err
 		}
-		return aesGCM.Seal(nil, nonce, data, nil), nil
+		return aesGCM.Seal(nil, nonce, data, ad), nil
 
 	default:
 		return nil, ErrInvalidMode
@@ -182,16 +245,40 @@ func Encrypt(key, nonce, data []byte, mode MODE) ([]byte, error) {
 // So you should compare it with the original data with a suitable hash function (see sha256, sha512 module...).
 // Otherwise, you can't be sure it is returning the correct data.
 //
+// The authenticated modes (GCM, ChaCha20-Poly1305, XChaCha20-Poly1305) and CBC mode are exceptions.
+// They return an error if the data cannot be authenticated.
+// In CBC mode the HMAC is checked before the padding, so a changed data is rejected without looking at its padding.
+//
 // If everything is working correctly, it returns  decrypted bytes and nil error.
 func Decrypt(key, nonce, data []byte, mode MODE) ([]byte, error) {
+	return DecryptWithAD(key, nonce, data, nil, mode)
+}
+
+// DecryptWithAD is Decrypt with the additional data given to EncryptWithAD.
+// The authenticated modes return an error if the additional data is not the same.
+func DecryptWithAD(key, nonce, data, ad []byte, mode MODE) ([]byte, error) {
+	if isAEAD(mode) && len(nonce) != NonceSize(mode) {
+		return nil, ErrInvalidNonce
+	}
 	if len(data) < aes.BlockSize {
 		return nil, ErrShortData
 	}
 
+	if mode == MODECHACHA20POLY1305 || mode == MODEXCHACHA20POLY1305 {
+		aead, err := newAEAD(key, mode)
+		if err != nil {
+			return nil, err
+		}
+		return aead.Open(nil, nonce, data, ad)
+	}
+
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
+	if mode == MODECBC {
+		return openCBC(block, key, data)
+	}
 	v := data[:aes.BlockSize]
 
 	var raw []byte
@@ -202,15 +289,6 @@ func Decrypt(key, nonce, data []byte, mode MODE) ([]byte, error) {
 	}
 
 	switch mode {
-	case MODECBC:
-		if len(data)%aes.BlockSize != 0 {
-			return nil, errors.New("cbc: data is not a multiple of the block size")
-		}
-
-		cbcMode := cipher.NewCBCDecrypter(block, v)
-		cbcMode.CryptBlocks(raw, data[aes.BlockSize:])
-		return raw, nil
-
 	case MODECFB:
 		modeCFB := cipher.NewCFBDecrypter(block, v)
 		modeCFB.XORKeyStream(raw, data[aes.BlockSize:])
@@ -234,7 +312,7 @@ func Decrypt(key, nonce, data []byte, mode MODE) ([]byte, error) {
 		if err != nil {
 			return nil, err
 		}
-		ret, err := aesGCM.Open(nil, nonce, data, nil)
+		ret, err := aesGCM.Open(nil, nonce, data, ad)
 		if err != nil {
 			data = nil
 			return nil, err
@@ -248,8 +326,29 @@ func Decrypt(key, nonce, data []byte, mode MODE) ([]byte, error) {
 
 }
 
+// entryDomain is written before the associated data of an entry, so it cannot be used for anything else.
+const entryDomain = "paket entry v1\x00"
+
+// AssociatedData returns the associated data of an entry for EncryptWithAD and DecryptWithAD:
+// the format version, the paket ID and the name of the entry.
+// version is 0 for legacy files. id is the random ID of the paket (Header.ID, or Option.ID for legacy files).
+//
+// The Writer, the Editor and the cmd tool seal every entry with it, and GetFile and the other read methods use it
+// for the entries of a container and the legacy entries with Values.AAD. Then the encrypted data of an entry cannot be swapped with another entry
+// or copied from another paket, even with the same key and a fixed table.
+func AssociatedData(version uint16, id []byte, name string) []byte {
+	var num [6]byte
+	binary.LittleEndian.PutUint16(num[0:], version)
+	binary.LittleEndian.PutUint32(num[2:], uint32(len(id)))
+	ad := make([]byte, 0, len(entryDomain)+len(num)+len(id)+len(name))
+	ad = append(ad, entryDomain...)
+	ad = append(ad, num[:]...)
+	ad = append(ad, id...)
+	return append(ad, name...)
+}
+
 // Paket that keeps the information of the file to be read.
-// It should be created with New.
+// It should be created with New, NewFromReaderAt or NewFromBytes.
 type Paket struct {
 	//
 	key []byte
@@ -263,35 +362,129 @@ type Paket struct {
 	//
 	table Datas
 
+	// header of the container file.
+	// nil for the legacy files that are read with a Go table.
+	header *Header
+
+	// start of the entry data: the end of the header. 0 for the legacy files.
+	dataStart int64
+
+	// paket ID of a legacy file (Option.ID). The ID of a container is in its header.
+	id []byte
+
+	// the entries of a legacy file have their own keys (Option.EntryKeys).
+	entryKeys bool
+
+	// the signature of the table is checked (Option.TrustedKey), so the encrypted data of every entry
+	// is checked against the signed hash before it is used. verified keeps the names of the checked entries.
+	trusted  bool
+	verified sync.Map
+
 	// created for access the file.
-	// This value is opened by New with filename parameter.
-	// file released with the Close function.
-	file *os.File
+	// This value is opened by New with filename parameter,
+	// or it is the reader given to NewFromReaderAt (a bytes.Reader for NewFromBytes).
+	file io.ReaderAt
+
+	// size of the paket data in file.
+	size int64
+
+	// released with the Close function. nil if the reader was given by the user.
+	closer io.Closer
 
-	// Used to prevent conflicts in GetFile. For files requested at the same time.
-	globMut sync.Mutex
+	// decrypted entries. nil if Option.CacheSize is 0.
+	cache *cache
+
+	// the memory mapped paket file (Option.Mmap). Entries are decrypted from it without copying.
+	// nil if the file is not mapped.
+	mapped []byte
+
+	// read lock for the read methods, so Close cannot release the file or the mapping while they use it.
+	// The read methods do not block each other.
+	mu sync.RWMutex
+
+	// set by Close. The read methods return fs.ErrClosed after it.
+	closed bool
 }
 
+// Option keeps the settings for New.
+//
+// For container files only Key and PaketFile are needed.
+// Iteration, KDF, Salt, Mode and Table are for the legacy files created with a Go table.
 type Option struct {
 	// Key value for reading the file's data
 	Key []byte
 
-	// PBDFK2 iteration
+	// PBDFK2 iteration (legacy only)
+	// Only used if KDF is not set.
 	Iteration uint
 
+	// key derivation function and its parameters (legacy only).
+	// The cmd tool writes it to the table as PaketKDF.
+	// If it is the zero value, PBKDF2 with Iteration is used.
+	KDF KDF
+
+	// key derivation pipeline that was used to create the paket (see KeyDerivationPipeline).
+	// It is required if the paket was created with a pipeline (-itertemplate in the cmd tool).
+	// For the legacy files, KDF and Iteration are not used if it is set.
+	Pipeline *KeyDerivationPipeline
+
+	// (legacy only)
 	Salt string
 
-	// paket file path
+	// name of the key slot to open (see KeySlot). Only for the pakets created with WriterOption.Envelope.
+	// If it is empty, all slots are tried in order.
+	KeySlot string
+
+	// X25519 private key (32 bytes) for a paket created with WriterOption.Recipients (see GenerateX25519Key).
+	// Key is not needed if it is set.
+	Identity []byte
+
+	// Ed25519 public key (32 bytes) of the build machine that signed the paket (see Sign).
+	// If it is set, New returns ErrNotSigned or ErrInvalidSignature unless the manifest is signed by this key.
+	// Then the encrypted data of every entry is checked against the signed hash (Values.HashEncrypt) at its first read,
+	// and the read methods return ErrHashMismatch for a changed entry.
+	TrustedKey []byte
+
+	// signature of a legacy file, returned by Sign and saved with the Go table (PaketSignature). (legacy only)
+	// Only checked if TrustedKey is set.
+	Signature []byte
+
+	// random ID of a legacy file, saved with the Go table (PaketID). (legacy only)
+	// It is a part of the associated data of the entries (see AssociatedData).
+	ID []byte
+
+	// the entries of a legacy file are encrypted with their own subkeys (see EntryKey).
+	// Saved with the Go table (PaketEntryKeys). (legacy only)
+	EntryKeys bool
+
+	// expected Merkle root of the paket (see Paket.MerkleRoot). If it is set, New returns ErrRootMismatch for any other root.
+	// A launcher can keep the root of each release, so no entry can be added, removed or swapped.
+	TrustedRoot []byte
+
+	// byte budget of the cache for decrypted entries.
+	// GetFile (with decrypt), GetGoroutineSafe and ReadFile return the cached data for the entries asked again,
+	// without reading, decrypting and hashing them. The least recently used entries are removed when the budget is full.
+	// 0 disables the cache. See Pin, Evict, Purge and CacheStats.
+	CacheSize int64
+
+	// paket file path.
+	// Not used by NewFromReaderAt and NewFromBytes.
 	PaketFile string
 
-	// encrypt/decrypt mode
+	// maps the paket file into memory (Linux only, only used by New).
+	// The entries are decrypted from the mapping, without reading and copying the encrypted data for each request.
+	// On other systems the file is read as usual.
+	Mmap bool
+
+	// encrypt/decrypt mode (legacy only)
 	Mode MODE
 
 	// Map value that keep the information of files in Paket.
 	// It must be at least 1 length.
 	// Otherwise, panic occurs at runtime.
 	//
-	// Usually created by the cmd tool.
+	// Usually created by the cmd tool with the legacy flag.
+	// If it is nil, the file is read as a container and the table comes from the file.
 	Table Datas
 }
 
@@ -300,6 +493,9 @@ type Option struct {
 //
 // key parameter refers to the encryption key.
 //
+// If o.Table is nil, the file must be a container file. Its header and index are read and checked.
+// ErrInvalidKey is returned if the index cannot be opened with the key.
+//
 // After getting all the data you need, should be terminated with  Close.
 func New(o Option) (*Paket, error) {
 	if !Exists(o.PaketFile) {
@@ -313,22 +509,188 @@ func New(o Option) (*Paket, error) {
 
 	fInfo, err := f.Stat()
 	if err != nil {
+		f.Close()
 		return nil, err
 	}
 
-	if fInfo.Size() < 13+16 {
+	if o.Mmap {
+		mapped, err := mmapFile(f, fInfo.Size())
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if mapped != nil {
+			// the mapping stays valid after the file is closed.
+			f.Close()
+			p, err := newPaket(bytes.NewReader(mapped), fInfo.Size(), o)
+			if err != nil {
+				munmap(mapped)
+				return nil, err
+			}
+			p.mapped = mapped
+			p.paketFileName = o.PaketFile
+			return p, nil
+		}
+	}
+
+	p, err := newPaket(f, fInfo.Size(), o)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	p.closer = f
+	p.paketFileName = o.PaketFile
+	return p, nil
+}
+
+// rlock locks p for a read method. It returns fs.ErrClosed if p is closed.
+// p.mu.RUnlock must be called if there is no error.
+func (p *Paket) rlock() error {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return fs.ErrClosed
+	}
+	return nil
+}
+
+// NewFromReaderAt creates a new Paket that reads the paket data from r.
+// size is the length of the paket data, for example the size of the file or of the embedded data.
+//
+// o is the same as for New, but o.PaketFile is not used.
+// r must not be changed while the Paket is used. Close does not close r.
+func NewFromReaderAt(r io.ReaderAt, size int64, o Option) (*Paket, error) {
+	if r == nil {
+		return nil, ErrNotFound
+	}
+	return newPaket(r, size, o)
+}
+
+// NewFromBytes creates a new Paket that reads the paket data from memory.
+// It can be used with a paket embedded in the program:
+//
+//	//go:embed data.pack
+//	var pack []byte
+//
+//	p, err := pengine.NewFromBytes(pack, pengine.Option{Key: key})
+//
+// data is not copied, it must not be changed while the Paket is used.
+func NewFromBytes(data []byte, o Option) (*Paket, error) {
+	return newPaket(bytes.NewReader(data), int64(len(data)), o)
+}
+
+// newPaket reads the header and the index of a container, or takes the table of a legacy file.
+func newPaket(r io.ReaderAt, size int64, o Option) (*Paket, error) {
+	if o.CacheSize < 0 {
+		return nil, errors.New("negative cache size")
+	}
+	if o.Table == nil {
+		p, err := openContainer(r, size, o)
+		if err == nil && o.CacheSize > 0 {
+			p.cache = newCache(o.CacheSize)
+		}
+		return p, err
+	}
+
+	if size < 13+16 {
 		return nil, errors.New("very short file")
 	}
 
+	if o.TrustedKey != nil {
+		m, err := o.legacyManifest()
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyManifest(o.TrustedKey, nil, o.Signature, m); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.TrustedRoot != nil && !bytes.Equal(o.TrustedRoot, merkleRoot(o.Table, 0)) {
+		return nil, ErrRootMismatch
+	}
+
+	var err error
 	p := new(Paket)
-	p.file = f
+	p.file = r
+	p.size = size
 	p.table = o.Table
-	if o.Iteration < 4096 {
-		o.Iteration = 4096
+	p.id = o.ID
+	p.entryKeys = o.EntryKeys
+	p.trusted = o.TrustedKey != nil
+	p.key, err = o.legacyKey()
+	if err != nil {
+		return nil, err
 	}
-	p.key = pbkdf2.Key(o.Key, []byte(o.Salt), int(o.Iteration), 32, sha256.New)
-	p.paketFileName = o.PaketFile
 	p.mode = o.Mode
+	if o.CacheSize > 0 {
+		p.cache = newCache(o.CacheSize)
+	}
+	return p, nil
+}
+
+// deriveKey derives the key from o.Key with the KDF, or with o.Pipeline if the KDF is KDFPIPELINE.
+func (o Option) deriveKey(kdf KDF, salt []byte) ([]byte, error) {
+	if kdf.Algorithm == KDFPIPELINE {
+		if o.Pipeline == nil {
+			return nil, ErrPipelineRequired
+		}
+		return o.Pipeline.Key(o.Key, salt)
+	}
+	return kdf.Key(o.Key, salt)
+}
+
+// legacyKDF returns the KDF of a legacy file.
+// If o.KDF is not set, PBKDF2 with o.Iteration is used.
+func (o Option) legacyKDF() KDF {
+	if o.Pipeline != nil {
+		return KDF{Algorithm: KDFPIPELINE}
+	}
+	if o.KDF.Algorithm == 0 {
+		return KDF{Algorithm: KDFPBKDF2, Iteration: o.Iteration}
+	}
+	return o.KDF
+}
+
+// legacyKey derives the key of a legacy file with o.Salt and legacyKDF.
+func (o Option) legacyKey() ([]byte, error) {
+	return o.deriveKey(o.legacyKDF(), []byte(o.Salt))
+}
+
+// openContainer reads the header and the index of a container file.
+func openContainer(f io.ReaderAt, size int64, o Option) (*Paket, error) {
+	h, dataStart, err := readHeader(f, size)
+	if err != nil {
+		return nil, err
+	}
+	p := new(Paket)
+	p.key, err = o.containerKey(h)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := readIndex(f, size, dataStart, p.key)
+	if err != nil {
+		return nil, err
+	}
+	if o.TrustedKey != nil {
+		m, err := containerManifest(h, idx.Entries, dataStart)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyManifest(o.TrustedKey, idx.Signer, idx.Signature, m); err != nil {
+			return nil, err
+		}
+	}
+	if o.TrustedRoot != nil && !bytes.Equal(o.TrustedRoot, merkleRoot(idx.Entries, dataStart)) {
+		return nil, ErrRootMismatch
+	}
+	p.table = idx.Entries
+	p.dataStart = dataStart
+	p.trusted = o.TrustedKey != nil
+	p.file = f
+	p.size = size
+	p.header = &h
+	p.mode = h.Mode
 	return p, nil
 }
 
@@ -349,35 +711,39 @@ func New(o Option) (*Paket, error) {
 // Both values do not have to be true. However, it may be good to generate a control mechanism like hash with your own work.
 // The decrypt (bool) value has been added for convenience. As a recommendation,
 // it is better to pass both values to true to this function.
+//
+// GetFile can be called from many goroutines at the same time. The data is read with ReadAt,
+// so the requests do not wait for each other. ErrTruncated is returned if the paket ends before the entry.
 func (p *Paket) GetFile(filename string, decrypt, shaControl bool) ([]byte, bool, error) {
+	if err := p.rlock(); err != nil {
+		return nil, false, err
+	}
+	defer p.mu.RUnlock()
+
 	file, found := p.table[filename]
 	if !found {
 		return nil, false, errors.New("File not found on map: " + filename)
 	}
 
-	p.globMut.Lock()
-	defer p.globMut.Unlock()
-
-	// We need the length of the encrypted data to be able to load to memory the file
-	length := file.EncryptLenght
-	// The position where our new file starts. Should be calculated based on the encrypted file length rather than the original file
-	start := file.StartPos
-
-	content := make([]byte, length)
+	// only the data with the correct hash is cached.
+	if decrypt {
+		if data, found := p.cacheGet(filename); found {
+			return data, shaControl, nil
+		}
+	}
 
-	// We go to the position of file
-	if _, err := p.file.Seek(int64(start), 0); err != nil {
+	// We read the encrypted data from its position, its length is the length of the encrypted data rather than the original file
+	content, err := p.readEncrypted(file, 0, file.EncryptLenght)
+	if err != nil {
 		return nil, false, err
 	}
-
-	// We read it to the position we want. So in this case, up to the position  where the encrypted data ends. We Alocated the *content* variable
-	if _, err := p.file.Read(content); err != nil {
+	if err := p.checkTrustedData(filename, file, content); err != nil {
 		return nil, false, err
 	}
 
 	switch decrypt {
 	case true:
-		decryptedData, err := Decrypt(p.key, file.Nonce, content, p.mode)
+		decryptedData, err := p.decrypt(filename, file, content)
 		if err != nil {
 			return nil, false, err
 		}
@@ -385,10 +751,19 @@ func (p *Paket) GetFile(filename string, decrypt, shaControl bool) ([]byte, bool
 		if shaControl {
 			getOriginalHash := sha256.Sum256(decryptedData)
 			tableOriginalHash := file.HashOriginal
-			return decryptedData, bytes.Equal(getOriginalHash[:], tableOriginalHash), nil
+			hashOK := bytes.Equal(getOriginalHash[:], tableOriginalHash)
+			if hashOK {
+				p.cacheAdd(filename, file, decryptedData, true)
+			}
+			return decryptedData, hashOK, nil
 		}
+		p.cacheAdd(filename, file, decryptedData, false)
 		return decryptedData, false, nil
 	case false:
+		if p.mapped != nil {
+			// the mapping is released by Close, the caller gets its own copy.
+			content = append([]byte(nil), content...)
+		}
 		if shaControl {
 			tableHash := file.HashEncrypt
 			getEncryptedHash := sha256.Sum256(content)
@@ -404,41 +779,61 @@ func (p *Paket) GetFile(filename string, decrypt, shaControl bool) ([]byte, bool
 // In any case, it only returns decrypted data.
 //
 // It does not do any hash checking.
+// It reads from the same file as GetFile, no new file is opened. (GetFile is safe for goroutines too.)
 func (p *Paket) GetGoroutineSafe(name string) ([]byte, error) {
+	if err := p.rlock(); err != nil {
+		return nil, err
+	}
+	defer p.mu.RUnlock()
+
 	file, found := p.table[name]
 	if !found {
 		return nil, errors.New("File not found on map: " + name)
 	}
-	length := file.EncryptLenght
-	encryptedLenght, _ := p.GetLen()
-	if length > encryptedLenght[1] {
-		return nil, errors.New("more length than file size")
+	if data, found := p.cacheGet(name); found {
+		return data, nil
 	}
-	start := file.StartPos
-
-	f, err := os.Open(p.paketFileName)
+	content, err := p.readEncrypted(file, 0, file.EncryptLenght)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-
-	if _, err := f.Seek(int64(start), 0); err != nil {
+	if err := p.checkTrustedData(name, file, content); err != nil {
 		return nil, err
 	}
-	content := make([]byte, length)
-	if _, err := f.Read(content); err != nil {
-		return nil, err
-	}
-	decryptedData, err := Decrypt(p.key, file.Nonce, content, p.mode)
+	decryptedData, err := p.decrypt(name, file, content)
 	if err != nil {
 		content = nil // I don't understand what the gc of Go does sometimes. A guarantee
 		return nil, err
 	}
 
 	content = nil // I don't understand what the gc of Go does sometimes. A guarantee
+	p.cacheAdd(name, file, decryptedData, false)
 	return decryptedData, nil
 }
 
+// Names returns the names of all files in Paket, sorted.
+//
+// Files packed from subfolders have slash-separated relative paths, like "textures/ui/button.png".
+func (p *Paket) Names() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	names := make([]string, 0, len(p.table))
+	for name := range p.table {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Entry returns the values of a file in the table (positions, lengths, hashes, nonce).
+// The second value is false if there is no file with this name.
+func (p *Paket) Entry(name string) (Values, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	v, found := p.table[name]
+	return v, found
+}
+
 // GetLen Returns the original and encrypted lengths of all files contained in Paket.
 // 0 index refers to the original, 1  index to the encrypted data.
 // In the meantime, no control is made. The same will return as the values are written into the table.
@@ -447,6 +842,8 @@ func (p *Paket) GetGoroutineSafe(name string) ([]byte, error) {
 //
 // returns an error if length is less than 1(see ErrMinimumMapValue). This case, other  things are 0.
 func (p *Paket) GetLen() ([2]int, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	values := [2]int{}
 	if len(p.table) < 1 {
 		return values, ErrMinimumMapValue
@@ -466,11 +863,35 @@ func (p *Paket) GetLen() ([2]int, error) {
 // When you call Close, you cannot access the Package again.
 //
 // Returns error for unsuccessful events.
+//
+// Close waits for the running reads. The read methods return fs.ErrClosed after Close.
 func (p *Paket) Close() error {
-	err := p.file.Close()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+
+	var err error
+	if p.closer != nil {
+		err = p.closer.Close()
+	}
+	if p.mapped != nil {
+		if merr := munmap(p.mapped); err == nil {
+			err = merr
+		}
+		p.mapped = nil
+	}
+	// the decrypted entries must not stay in memory after Close.
+	if p.cache != nil {
+		p.cache.clear()
+	}
 	p.key = nil
 	p.table = nil
+	p.header = nil
 	p.file = nil
+	p.closer = nil
 	p = nil
 	return err
 }
@@ -0,0 +1,233 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// testFiles are the entries written by writeTestPaket.
+var testFiles = map[string][]byte{
+	"readme.txt":       []byte("hello paket"),
+	"ui/index.html":    bytes.Repeat([]byte("<p>paket</p>\n"), 500),
+	"ui/img/logo.bin":  testRandom(70000),
+	"sounds/click.wav": testRandom(100),
+	"empty":            nil,
+}
+
+// testRandom returns n bytes that do not compress.
+func testRandom(n int) []byte {
+	b := make([]byte, n)
+	x := uint32(2463534242)
+	for i := range b {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		b[i] = byte(x)
+	}
+	return b
+}
+
+// writeTestPaket writes files to a new container in a temporary folder and returns its path.
+func writeTestPaket(t *testing.T, o WriterOption, files map[string][]byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.pack")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWriter(f, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := w.Add(name, files[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// openTestPaket opens the paket at path with the key "test key".
+func openTestPaket(t *testing.T, path string) *Paket {
+	t.Helper()
+	p, err := New(Option{Key: []byte("test key"), PaketFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+// testModes are all encryption modes.
+var testModes = []MODE{MODECBC, MODECFB, MODECTR, MODEOFB, MODEGCM, MODECHACHA20POLY1305, MODEXCHACHA20POLY1305}
+
+// testCompressions are all compressions.
+var testCompressions = []COMPRESSION{COMPRESSNONE, COMPRESSDEFLATE, COMPRESSZSTD}
+
+// checkTestFiles reads all testFiles from p with GetFile and checks their content.
+func checkTestFiles(t *testing.T, p *Paket) {
+	t.Helper()
+	for name, want := range testFiles {
+		data, ok, err := p.GetFile(name, true, true)
+		if err != nil || !ok {
+			t.Fatalf("GetFile(%q): %v, %v", name, ok, err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Fatalf("GetFile(%q): wrong content", name)
+		}
+	}
+	if _, ok, _ := p.GetFile("missing", true, true); ok {
+		t.Fatal("GetFile found a missing entry")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, mode := range testModes {
+		for _, c := range testCompressions {
+			for _, envelope := range []bool{false, true} {
+				path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: mode, Compression: c, Envelope: envelope}, testFiles)
+				checkTestFiles(t, openTestPaket(t, path))
+
+				if _, err := New(Option{Key: []byte("wrong key"), PaketFile: path}); err == nil {
+					t.Fatalf("mode %d, compression %d: opened with a wrong key", mode, c)
+				}
+			}
+		}
+	}
+}
+
+func TestRoundTripLegacy(t *testing.T) {
+	for _, mode := range testModes {
+		for _, c := range testCompressions {
+			path := filepath.Join(t.TempDir(), "legacy.pack")
+			if err := os.WriteFile(path, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			o := Option{Key: []byte("test key"), PaketFile: path, Table: Datas{}, Mode: mode, Salt: "legacy salt", ID: testRandom(16), EntryKeys: true}
+			e, err := OpenEditor(o, EditorOption{Compression: c})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, data := range testFiles {
+				if _, err := e.Add(name, data); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			o.Table = e.Table()
+			p, err := New(o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkTestFiles(t, p)
+			p.Close()
+		}
+	}
+}
+
+func TestNewFromBytes(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM, Compression: COMPRESSDEFLATE}, testFiles)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewFromBytes(data, Option{Key: []byte("test key")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestFiles(t, p)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFromBytes(data[:len(data)-1], Option{Key: []byte("test key")}); err == nil {
+		t.Error("truncated data is opened")
+	}
+	if _, err := NewFromBytes(nil, Option{Key: []byte("test key")}); err == nil {
+		t.Error("empty data is opened")
+	}
+
+	legacy := writeTestLegacyPaket(t, MODECTR)
+	data, err = os.ReadFile(legacy.PaketFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy.PaketFile = ""
+	p, err = NewFromBytes(data, legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	checkTestFiles(t, p)
+}
+
+func TestNewFromReaderAt(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODECHACHA20POLY1305}, testFiles)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the paket is in the middle of other data, like a paket appended to an executable.
+	blob := append(append(testRandom(1000), data...), testRandom(10)...)
+	r := io.NewSectionReader(bytes.NewReader(blob), 1000, int64(len(data)))
+	p, err := NewFromReaderAt(r, r.Size(), Option{Key: []byte("test key")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestFiles(t, p)
+	f, err := p.Open("ui/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(f); err != nil || !bytes.Equal(got, testFiles["ui/index.html"]) {
+		t.Fatalf("Open: %v", err)
+	}
+	f.Close()
+	p.Close()
+
+	// Close does not close r.
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = NewFromReaderAt(file, info.Size(), Option{Key: []byte("test key")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+	if _, err := file.ReadAt(make([]byte, 1), 0); err != nil {
+		t.Errorf("r is closed by Close: %v", err)
+	}
+
+	if _, err := NewFromReaderAt(nil, 0, Option{Key: []byte("test key")}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("nil reader: %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/sha3"
+)
+
+// ErrPipelineRequired is returned by New when the paket was created with a KeyDerivationPipeline
+// and Option.Pipeline is nil. The pipeline is not saved with the paket.
+var ErrPipelineRequired = errors.New("paket was created with a key derivation pipeline, Option.Pipeline is required")
+
+// pipelineHashes are the hash functions that can be used in a pipeline stage.
+var pipelineHashes = map[string]func() hash.Hash{
+	"md5":         md5.New,
+	"sha1":        sha1.New,
+	"sha224":      sha256.New224,
+	"sha256":      sha256.New,
+	"sha384":      sha512.New384,
+	"sha512":      sha512.New,
+	"sha3-256":    sha3.New256,
+	"sha3-512":    sha3.New512,
+	"blake2b-256": func() hash.Hash { h, _ := blake2b.New256(nil); return h },
+	"blake2b-512": func() hash.Hash { h, _ := blake2b.New512(nil); return h },
+}
+
+// PipelineStage is one stage of a KeyDerivationPipeline.
+type PipelineStage struct {
+	// name of the hash function: md5, sha1, sha224, sha256, sha384, sha512,
+	// sha3-256, sha3-512, blake2b-256 or blake2b-512.
+	Hash string `json:"hash"`
+
+	// PBKDF2 iteration for this stage. Must be at least 1.
+	Iteration int `json:"iteration"`
+}
+
+// KeyDerivationPipeline is a chain of PBKDF2 stages with different hash functions and iteration counts.
+// The output of each stage is the input of the next stage. The first stage gets the key.
+// The output of the last stage is hashed with sha256 to get the 32 byte key.
+//
+// It is usually loaded from a JSON template (see LoadKeyDerivationPipeline):
+//
+//	{
+//		"stages": [
+//			{"hash": "md5", "iteration": 55},
+//			{"hash": "sha256", "iteration": 2000},
+//			{"hash": "md5", "iteration": 5000},
+//			{"hash": "sha512", "iteration": 12000}
+//		]
+//	}
+//
+// The pipeline is not saved with the paket, only the fact that a pipeline was used.
+// The reader must pass the same pipeline with Option.Pipeline.
+type KeyDerivationPipeline struct {
+	Stages []PipelineStage `json:"stages"`
+}
+
+// ParseKeyDerivationPipeline parses a JSON template and checks its stages.
+func ParseKeyDerivationPipeline(data []byte) (*KeyDerivationPipeline, error) {
+	kp := new(KeyDerivationPipeline)
+	if err := json.Unmarshal(data, kp); err != nil {
+		return nil, err
+	}
+	if err := kp.check(); err != nil {
+		return nil, err
+	}
+	return kp, nil
+}
+
+// LoadKeyDerivationPipeline reads and parses the JSON template file.
+func LoadKeyDerivationPipeline(path string) (*KeyDerivationPipeline, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyDerivationPipeline(data)
+}
+
+// check returns an error for an empty pipeline, unknown hash functions and invalid iterations.
+func (kp *KeyDerivationPipeline) check() error {
+	if len(kp.Stages) == 0 {
+		return errors.New("pipeline has no stages")
+	}
+	for _, stage := range kp.Stages {
+		if _, found := pipelineHashes[strings.ToLower(stage.Hash)]; !found {
+			return errors.New("unknown hash function in pipeline: " + stage.Hash)
+		}
+		if stage.Iteration < 1 {
+			return errors.New("pipeline iteration must be at least 1: " + stage.Hash)
+		}
+	}
+	return nil
+}
+
+// Key derives a 32 byte key from the password and the salt by running the stages in order.
+func (kp *KeyDerivationPipeline) Key(password, salt []byte) ([]byte, error) {
+	if err := kp.check(); err != nil {
+		return nil, err
+	}
+	out := password
+	for _, stage := range kp.Stages {
+		h := pipelineHashes[strings.ToLower(stage.Hash)]
+		out = pbkdf2.Key(out, salt, stage.Iteration, h().Size(), h)
+	}
+	key := sha256.Sum256(out)
+	return key[:], nil
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testPipeline = `{
+	"stages": [
+		{"hash": "md5", "iteration": 55},
+		{"hash": "SHA256", "iteration": 200},
+		{"hash": "blake2b-512", "iteration": 10}
+	]
+}`
+
+func TestParseKeyDerivationPipeline(t *testing.T) {
+	kp, err := ParseKeyDerivationPipeline([]byte(testPipeline))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kp.Stages) != 3 || kp.Stages[1].Hash != "SHA256" || kp.Stages[1].Iteration != 200 {
+		t.Fatalf("stages: %v", kp.Stages)
+	}
+
+	invalid := []string{
+		`{"stages": []}`,
+		`{"stages": [{"hash": "whirlpool", "iteration": 10}]}`,
+		`{"stages": [{"hash": "sha1", "iteration": 0}]}`,
+		`{"stages": `,
+	}
+	for _, data := range invalid {
+		if _, err := ParseKeyDerivationPipeline([]byte(data)); err == nil {
+			t.Errorf("%s is accepted", data)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "pipeline.json")
+	if err := os.WriteFile(path, []byte(testPipeline), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadKeyDerivationPipeline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Stages) != len(kp.Stages) {
+		t.Error("LoadKeyDerivationPipeline returned other stages")
+	}
+}
+
+func TestKeyDerivationPipelineKey(t *testing.T) {
+	kp, err := ParseKeyDerivationPipeline([]byte(testPipeline))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := kp.Key([]byte("test key"), []byte("salt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != 32 {
+		t.Fatalf("key length %d", len(key))
+	}
+	again, _ := kp.Key([]byte("test key"), []byte("salt"))
+	if !bytes.Equal(key, again) {
+		t.Error("the key is not the same for the same input")
+	}
+	for _, other := range [][2]string{{"other key", "salt"}, {"test key", "other salt"}} {
+		if k, _ := kp.Key([]byte(other[0]), []byte(other[1])); bytes.Equal(k, key) {
+			t.Errorf("%v gives the same key", other)
+		}
+	}
+
+	// the order of the stages changes the key.
+	swapped := &KeyDerivationPipeline{Stages: []PipelineStage{kp.Stages[1], kp.Stages[0], kp.Stages[2]}}
+	if k, _ := swapped.Key([]byte("test key"), []byte("salt")); bytes.Equal(k, key) {
+		t.Error("the swapped stages give the same key")
+	}
+	if _, err := (&KeyDerivationPipeline{}).Key([]byte("test key"), []byte("salt")); err == nil {
+		t.Error("an empty pipeline gives a key")
+	}
+}
+
+func TestPipelineRoundTrip(t *testing.T) {
+	kp, err := ParseKeyDerivationPipeline([]byte(testPipeline))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, envelope := range []bool{false, true} {
+		path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM, Pipeline: kp, Envelope: envelope}, testFiles)
+		p, err := New(Option{Key: []byte("test key"), PaketFile: path, Pipeline: kp})
+		if err != nil {
+			t.Fatalf("envelope %v: %v", envelope, err)
+		}
+		checkTestFiles(t, p)
+		p.Close()
+
+		if _, err := New(Option{Key: []byte("test key"), PaketFile: path}); !errors.Is(err, ErrPipelineRequired) {
+			t.Errorf("envelope %v: without Pipeline: %v, want ErrPipelineRequired", envelope, err)
+		}
+		other := &KeyDerivationPipeline{Stages: kp.Stages[:2]}
+		if _, err := New(Option{Key: []byte("test key"), PaketFile: path, Pipeline: other}); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("envelope %v: other pipeline: %v, want ErrInvalidKey", envelope, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrInvalidRange is returned by GetRange for a negative offset or length, or an offset after the end of the entry.
+var ErrInvalidRange = errors.New("invalid range")
+
+// GetRange returns length bytes of the decrypted entry, starting at offset.
+// A range that goes after the end of the entry is cut, so fewer bytes can be returned.
+// offset can be the length of the entry, then nothing is returned.
+//
+// Only the data of the range is read and decrypted:
+// in the stream modes (CTR, CFB, OFB) the key stream is moved to the offset,
+// in the authenticated modes the chunks of the range are decrypted, and every chunk is checked before its bytes are returned.
+// The other entries are decrypted as a whole: CBC entries, the entries of authenticated modes written without chunks (legacy tables)
+// and the compressed entries, which are decompressed from the start (see File).
+// If the entry is in the cache, the range is copied from it. It is counted as a cache hit,
+// but a range of an entry that is not in the cache is not counted as a miss: the entry is not added to the cache.
+//
+// The hash of the original file is not checked, it needs the whole entry. Use GetFile for it.
+// Returns an error that wraps fs.ErrNotExist if there is no entry with this name.
+func (p *Paket) GetRange(name string, offset, length int64) ([]byte, error) {
+	if offset < 0 || length < 0 {
+		return nil, ErrInvalidRange
+	}
+	if err := p.rlock(); err != nil {
+		return nil, err
+	}
+	data, found := p.cachePeek(name)
+	p.mu.RUnlock()
+	if found {
+		size := int64(len(data))
+		if offset > size {
+			return nil, ErrInvalidRange
+		}
+		if length > size-offset {
+			length = size - offset
+		}
+		return append([]byte(nil), data[offset:offset+length]...), nil
+	}
+
+	f, err := p.OpenFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	size := int64(f.v.OriginalLenght)
+	if offset > size {
+		return nil, ErrInvalidRange
+	}
+	if length > size-offset {
+		length = size - offset
+	}
+	out := make([]byte, length)
+	n, err := f.ReadAt(out, offset)
+	if err == io.EOF && int64(n) == length {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,122 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"math"
+	"testing"
+)
+
+func TestGetRange(t *testing.T) {
+	data := testFiles["ui/img/logo.bin"]
+	for _, mode := range testModes {
+		for _, c := range []COMPRESSION{COMPRESSNONE, COMPRESSZSTD} {
+			path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: mode, ChunkSize: 1000, Compression: c}, testFiles)
+			p := openTestPaket(t, path)
+			for _, r := range [][2]int64{{0, 10}, {999, 2}, {1000, 1000}, {12345, 54321}, {69990, 100}, {70000, 5}} {
+				got, err := p.GetRange("ui/img/logo.bin", r[0], r[1])
+				if err != nil {
+					t.Fatalf("%v %v %v: %v", mode, c, r, err)
+				}
+				end := r[0] + r[1]
+				if end > int64(len(data)) {
+					end = int64(len(data))
+				}
+				if !bytes.Equal(got, data[r[0]:end]) {
+					t.Fatalf("%v %v %v: wrong data", mode, c, r)
+				}
+			}
+			if _, err := p.GetRange("ui/img/logo.bin", 70001, 1); err != ErrInvalidRange {
+				t.Errorf("after the end: %v", err)
+			}
+			if _, err := p.GetRange("missing", 0, 1); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("missing entry: %v", err)
+			}
+		}
+	}
+}
+
+func TestGetRangeCacheAfterClose(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM}, testFiles)
+	p, err := New(Option{Key: []byte("test key"), PaketFile: path, CacheSize: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Pin("readme.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := p.GetRange("readme.txt", 0, 5); err != nil || string(got) != "hello" {
+		t.Fatalf("%q %v", got, err)
+	}
+	p.Close()
+	if _, err := p.GetRange("readme.txt", 0, 5); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("after Close: %v", err)
+	}
+	if s := p.CacheStats(); s.Entries != 0 || s.Bytes != 0 {
+		t.Errorf("cache is not cleared: %+v", s)
+	}
+}
+
+// a length after the end of the entry is cut, also when it overflows offset+length.
+func TestGetRangeLargeLength(t *testing.T) {
+	data := testFiles["ui/img/logo.bin"]
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM}, testFiles)
+	p, err := New(Option{Key: []byte("test key"), PaketFile: path, CacheSize: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	for _, cached := range []bool{false, true} {
+		if cached {
+			if err := p.Pin("ui/img/logo.bin"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := p.GetRange("ui/img/logo.bin", 1, math.MaxInt64)
+		if err != nil {
+			t.Fatalf("cached %v: %v", cached, err)
+		}
+		if !bytes.Equal(got, data[1:]) {
+			t.Fatalf("cached %v: wrong data", cached)
+		}
+		if got, err := p.GetRange("ui/img/logo.bin", int64(len(data)), math.MaxInt64); err != nil || len(got) != 0 {
+			t.Fatalf("cached %v: range at the end: %d bytes, %v", cached, len(got), err)
+		}
+	}
+}
+
+// a range read is a hit if the entry is in the cache, but it is not a miss: it does not add the entry.
+func TestGetRangeCacheStats(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM}, testFiles)
+	p, err := New(Option{Key: []byte("test key"), PaketFile: path, CacheSize: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := p.GetRange("readme.txt", 0, 5); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := p.CacheStats(); s.Hits != 0 || s.Misses != 0 || s.Entries != 0 {
+		t.Fatalf("uncached ranges: %+v", s)
+	}
+
+	if _, _, err := p.GetFile("readme.txt", true, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.GetRange("readme.txt", 0, 5); err != nil {
+		t.Fatal(err)
+	}
+	if s := p.CacheStats(); s.Hits != 1 || s.Misses != 1 || s.Entries != 1 {
+		t.Fatalf("cached range: %+v", s)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+var (
+	// ErrIdentityRequired is returned when a paket can only be opened by its X25519 recipients and Option.Identity is not set.
+	ErrIdentityRequired = errors.New("paket is sealed for X25519 recipients, Option.Identity is required")
+
+	// ErrInvalidX25519Key is returned for X25519 keys that are not 32 bytes, or for a low order public key.
+	ErrInvalidX25519Key = errors.New("invalid X25519 key")
+)
+
+// x25519Info separates the keys of the recipient slots from the other uses of the shared secret.
+const x25519Info = "paket x25519 key slot"
+
+// Recipient is an X25519 public key that can open a paket with its private key.
+//
+// For every recipient, a key slot is sealed with a key agreed between a new random (ephemeral) key pair and the public key,
+// like age. Only the public keys are needed to create the paket, so a build machine does not need to keep any secret.
+// The clients open the paket with their private key in Option.Identity.
+type Recipient struct {
+	// name of the key slot, like "client-eu". If it is empty, the fingerprint of the public key is used (see X25519Fingerprint).
+	Name string
+
+	// 32 byte X25519 public key, created by GenerateX25519Key.
+	PublicKey []byte
+}
+
+// GenerateX25519Key creates a new X25519 key pair for Recipient and Option.Identity.
+// Keep privateKey secret, publicKey can be given to the build machines.
+func GenerateX25519Key() (publicKey, privateKey []byte, err error) {
+	privateKey, err = CreateRandomBytes(curve25519.ScalarSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKey, err = X25519PublicKey(privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return publicKey, privateKey, nil
+}
+
+// X25519PublicKey returns the public key of an X25519 private key.
+func X25519PublicKey(privateKey []byte) ([]byte, error) {
+	if len(privateKey) != curve25519.ScalarSize {
+		return nil, ErrInvalidX25519Key
+	}
+	return curve25519.X25519(privateKey, curve25519.Basepoint)
+}
+
+// X25519Fingerprint returns a short name for a public key: the first 8 bytes of its sha256 hash, hex encoded.
+func X25519Fingerprint(publicKey []byte) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+// recipientSlotKey returns the key that wraps the data key of a recipient slot.
+// shared is the X25519 result, ephemeral and recipient are the two public keys.
+func recipientSlotKey(shared, ephemeral, recipient []byte) ([]byte, error) {
+	salt := append(append([]byte(nil), ephemeral...), recipient...)
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(x25519Info)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// newRecipientSlot wraps dek for the public key of r.
+// The ephemeral public key is written to Salt, and the public key of the recipient to Recipient.
+func newRecipientSlot(r Recipient, dek []byte) (KeySlot, error) {
+	if len(r.PublicKey) != curve25519.PointSize {
+		return KeySlot{}, ErrInvalidX25519Key
+	}
+	if r.Name == "" {
+		r.Name = X25519Fingerprint(r.PublicKey)
+	}
+	ephemeralPublic, ephemeralPrivate, err := GenerateX25519Key()
+	if err != nil {
+		return KeySlot{}, err
+	}
+	// X25519 returns an error for the low order points, they would give a known shared secret.
+	shared, err := curve25519.X25519(ephemeralPrivate, r.PublicKey)
+	if err != nil {
+		return KeySlot{}, ErrInvalidX25519Key
+	}
+	slotKey, err := recipientSlotKey(shared, ephemeralPublic, r.PublicKey)
+	if err != nil {
+		return KeySlot{}, err
+	}
+	nonce, err := CreateRandomBytes(16)
+	if err != nil {
+		return KeySlot{}, err
+	}
+	slot := KeySlot{
+		Name:      r.Name,
+		KDF:       KDF{Algorithm: KDFX25519},
+		Salt:      ephemeralPublic,
+		Nonce:     nonce[:12],
+		Recipient: append([]byte(nil), r.PublicKey...),
+	}
+	slot.Key, err = Encrypt(slotKey, slot.Nonce, dek, MODEGCM)
+	if err != nil {
+		return KeySlot{}, err
+	}
+	return slot, nil
+}
+
+// recipientKey returns the wrapping key of a recipient slot for the private key identity.
+// ok is false if the slot is for another recipient.
+func recipientKey(identity []byte, slot KeySlot) (key []byte, ok bool, err error) {
+	public, err := X25519PublicKey(identity)
+	if err != nil {
+		return nil, false, err
+	}
+	if !bytes.Equal(public, slot.Recipient) {
+		return nil, false, nil
+	}
+	shared, err := curve25519.X25519(identity, slot.Salt)
+	if err != nil {
+		return nil, false, ErrInvalidX25519Key
+	}
+	key, err = recipientSlotKey(shared, slot.Salt, slot.Recipient)
+	return key, err == nil, err
+}
+
+// AddRecipient adds a key slot for an X25519 public key to the container file o.PaketFile.
+// o opens the paket like New, with a password or with Option.Identity. See AddKeySlot.
+func AddRecipient(o Option, r Recipient) error {
+	return rewriteHeader(o, o.PaketFile, func(h *Header, dek []byte, opened int) error {
+		slot, err := newRecipientSlot(r, dek)
+		if err != nil {
+			return err
+		}
+		for _, s := range h.Slots {
+			if s.Name == slot.Name {
+				return errors.New("there is already a key slot with this name: " + slot.Name)
+			}
+		}
+		h.Slots = append(h.Slots, slot)
+		return nil
+	})
+}
@@ -0,0 +1,90 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRecipients(t *testing.T) {
+	public1, private1, err := GenerateX25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	public2, private2, err := GenerateX25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, other, err := GenerateX25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipients := []Recipient{{Name: "client-eu", PublicKey: public1}, {PublicKey: public2}}
+	path := writeTestPaket(t, WriterOption{Mode: MODEGCM, Recipients: recipients}, testFiles)
+
+	if got := slotNames(t, path); len(got) != 2 || got[0] != "client-eu" || got[1] != X25519Fingerprint(public2) {
+		t.Fatalf("slots: %v", got)
+	}
+	for _, identity := range [][]byte{private1, private2} {
+		p, err := New(Option{PaketFile: path, Identity: identity})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTestFiles(t, p)
+		p.Close()
+	}
+
+	if _, err := New(Option{Key: []byte("test key"), PaketFile: path}); !errors.Is(err, ErrIdentityRequired) {
+		t.Errorf("without Identity: %v, want ErrIdentityRequired", err)
+	}
+	if _, err := New(Option{PaketFile: path, Identity: other}); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("other identity: %v, want ErrInvalidKey", err)
+	}
+	if _, err := New(Option{PaketFile: path, Identity: private2, KeySlot: "client-eu"}); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("identity of another slot: %v, want ErrInvalidKey", err)
+	}
+	if _, err := New(Option{PaketFile: path, Identity: private1[:31]}); !errors.Is(err, ErrInvalidX25519Key) {
+		t.Errorf("short identity: %v, want ErrInvalidX25519Key", err)
+	}
+}
+
+func TestAddRecipient(t *testing.T) {
+	public, private, err := GenerateX25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODECTR, Envelope: true}, testFiles)
+	o := Option{Key: []byte("test key"), PaketFile: path}
+	if err := AddRecipient(o, Recipient{PublicKey: public[:16]}); !errors.Is(err, ErrInvalidX25519Key) {
+		t.Errorf("short public key: %v, want ErrInvalidX25519Key", err)
+	}
+	if err := AddRecipient(o, Recipient{Name: defaultSlotName, PublicKey: public}); err == nil {
+		t.Error("a recipient with the name of another slot is added")
+	}
+	if err := AddRecipient(o, Recipient{Name: "client", PublicKey: public}); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := New(Option{PaketFile: path, Identity: private})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	checkTestFiles(t, p)
+	// the password slot still opens the paket, the recipient slot is skipped without Identity.
+	checkTestFiles(t, openTestPaket(t, path))
+
+	// a recipient can rewrap its slot to a password.
+	if err := RewrapKeySlot(Option{PaketFile: path, Identity: private}, []byte("client key"), KDF{}, path); err != nil {
+		t.Fatal(err)
+	}
+	q, err := New(Option{Key: []byte("client key"), PaketFile: path, KeySlot: "client"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Close()
+}
@@ -0,0 +1,150 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Rekey encrypts all entries of a paket again with a new key.
+//
+// o opens the old paket, like New. n keeps the new key and KDF, like NewWriter.
+// If n.Mode is 0, the mode of the old paket is kept. The compression of the entries is kept.
+// The hash of every entry is checked before it is encrypted again.
+//
+// The new paket is written to a temporary file next to dst and renamed to dst at the end.
+// dst can be the same as o.PaketFile, the old file is replaced only if there is no error.
+//
+// The returned Option opens the new paket. A container stays a container,
+// with key slots if n.Envelope is set (only the "default" slot, the other slots are not kept).
+// For a paket with key slots, RewrapKeySlot is faster if only a password must be changed.
+// n.Recipients get their own slots; if n.Key is empty, the returned Option needs an Identity to open the new paket.
+// For legacy files, a new random salt and paket ID are created, and the entries get their own keys (see EntryKey).
+// The returned Option keeps the new Table, Salt, KDF, ID and EntryKeys:
+// they must be saved in the new Go table.
+//
+// The new paket is signed if n.SigningKey is set (for a legacy file, the returned Option keeps the Signature).
+// Otherwise the signature of the old paket is not kept.
+func Rekey(o Option, n WriterOption, dst string) (Option, error) {
+	if len(n.Key) == 0 && len(n.Recipients) == 0 {
+		return Option{}, errors.New("new key cannot be empty")
+	}
+	if n.ChunkSize < 0 {
+		return Option{}, errors.New("negative chunk size")
+	}
+	if n.ChunkSize == 0 {
+		n.ChunkSize = DefaultChunkSize
+	}
+	p, err := New(o)
+	if err != nil {
+		return Option{}, err
+	}
+	defer p.Close()
+	if n.Mode == 0 {
+		n.Mode = p.mode
+	}
+
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(o.PaketFile); err == nil {
+		perm = info.Mode()
+	}
+	newOption := Option{Key: n.Key, Pipeline: n.Pipeline, PaketFile: dst}
+	err = replaceFile(dst, perm, func(tmp *os.File) error {
+		if p.header != nil {
+			return p.rekeyContainer(tmp, n)
+		}
+		return p.rekeyLegacy(tmp, n, &newOption)
+	}, p.Close)
+	if err != nil {
+		return Option{}, err
+	}
+	return newOption, nil
+}
+
+// rekeyContainer writes the entries of p to a new container in tmp.
+func (p *Paket) rekeyContainer(tmp *os.File, n WriterOption) error {
+	w, err := NewWriter(tmp, n)
+	if err != nil {
+		return err
+	}
+	for _, name := range p.Names() {
+		data, err := p.getChecked(name)
+		if err != nil {
+			return err
+		}
+		w.compression = p.table[name].Compression
+		if _, err := w.Add(name, data); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// rekeyLegacy writes the entries of the legacy paket p to tmp, and sets the new table and key parameters in newOption.
+func (p *Paket) rekeyLegacy(tmp *os.File, n WriterOption, newOption *Option) error {
+	if len(n.Key) == 0 {
+		return errors.New("new key cannot be empty, a legacy paket has no key slots for recipients")
+	}
+	salt, err := CreateRandomBytes(32)
+	if err != nil {
+		return err
+	}
+	newOption.Salt = hex.EncodeToString(salt)
+	newOption.ID, err = CreateRandomBytes(16)
+	if err != nil {
+		return err
+	}
+	newOption.KDF = n.kdf()
+	newOption.EntryKeys = true
+	newOption.Mode = n.Mode
+	newOption.Table = make(Datas, len(p.table))
+	key, err := newOption.legacyKey()
+	if err != nil {
+		return err
+	}
+
+	offset := 0
+	for _, name := range p.Names() {
+		data, err := p.getChecked(name)
+		if err != nil {
+			return err
+		}
+		// legacy entries are one block.
+		v, encData, err := sealEntry(EntryKey(key, newOption.ID, name), n.Mode, 0, p.table[name].Compression, name, data, AssociatedData(0, newOption.ID, name))
+		if err != nil {
+			return err
+		}
+		if _, err := tmp.Write(encData); err != nil {
+			return err
+		}
+		v.StartPos = offset
+		v.EndPos = offset + len(encData)
+		offset = v.EndPos
+		newOption.Table[name] = v
+	}
+	if n.SigningKey != nil {
+		newOption.Signature, err = Sign(*newOption, n.SigningKey)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getChecked returns the decrypted data of the entry, or ErrHashMismatch.
+func (p *Paket) getChecked(name string) ([]byte, error) {
+	data, ok, err := p.GetFile(name, true, true)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrHashMismatch, name)
+	}
+	return data, nil
+}
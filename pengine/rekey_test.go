@@ -0,0 +1,160 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestLegacyPaket writes testFiles to a new legacy paket and returns the Option to open it.
+func writeTestLegacyPaket(t *testing.T, mode MODE) Option {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "legacy.pack")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	o := Option{Key: []byte("test key"), PaketFile: path, Table: Datas{}, Mode: mode, Salt: "legacy salt", ID: testRandom(16), EntryKeys: true}
+	e, err := OpenEditor(o, EditorOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range testFiles {
+		if _, err := e.Add(name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	o.Table = e.Table()
+	return o
+}
+
+func TestRekey(t *testing.T) {
+	for _, envelope := range []bool{false, true} {
+		path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM, Envelope: envelope}, testFiles)
+		dst := filepath.Join(t.TempDir(), "new.pack")
+		n, err := Rekey(Option{Key: []byte("test key"), PaketFile: path}, WriterOption{Key: []byte("new key"), Envelope: envelope}, dst)
+		if err != nil {
+			t.Fatalf("envelope %v: %v", envelope, err)
+		}
+
+		p, err := New(n)
+		if err != nil {
+			t.Fatalf("envelope %v: opening with the returned Option: %v", envelope, err)
+		}
+		checkTestFiles(t, p)
+		if p.mode != MODEGCM {
+			t.Errorf("envelope %v: mode %d, want the old mode", envelope, p.mode)
+		}
+		p.Close()
+		if _, err := New(Option{Key: []byte("test key"), PaketFile: dst}); err == nil {
+			t.Errorf("envelope %v: the new paket is opened with the old key", envelope)
+		}
+		// the source is not changed when dst is another file.
+		checkTestFiles(t, openTestPaket(t, path))
+	}
+}
+
+func TestRekeyInPlace(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM}, testFiles)
+	n, err := Rekey(Option{Key: []byte("test key"), PaketFile: path}, WriterOption{Key: []byte("new key"), Mode: MODECHACHA20POLY1305, Compression: COMPRESSZSTD}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := New(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	checkTestFiles(t, p)
+	if p.mode != MODECHACHA20POLY1305 {
+		t.Errorf("mode %d, want MODECHACHA20POLY1305", p.mode)
+	}
+	if _, err := New(Option{Key: []byte("test key"), PaketFile: path}); err == nil {
+		t.Error("the paket is still opened with the old key")
+	}
+}
+
+func TestRekeyLegacy(t *testing.T) {
+	o := writeTestLegacyPaket(t, MODECTR)
+	n, err := Rekey(o, WriterOption{Key: []byte("new key"), Mode: MODEGCM}, o.PaketFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Table == nil || n.Mode != MODEGCM || bytes.Equal(n.Key, o.Key) {
+		t.Fatalf("returned Option: mode %d, table %v", n.Mode, n.Table != nil)
+	}
+	p, err := New(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	checkTestFiles(t, p)
+
+	// a legacy paket is opened without a check, the old key cannot read the new entries.
+	old, err := New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+	if _, ok, err := old.GetFile("ui/index.html", true, true); err == nil && ok {
+		t.Error("the entry is still read with the old key and table")
+	}
+}
+
+func TestRekeyKeepsFileOnError(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODECTR}, testFiles)
+	v, _ := openTestPaket(t, path).Entry("ui/index.html")
+	corruptEntry(t, path, v)
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Rekey(Option{Key: []byte("test key"), PaketFile: path}, WriterOption{Key: []byte("new key")}, path)
+	if !errors.Is(err, ErrHashMismatch) {
+		t.Fatalf("Rekey returned %v, want ErrHashMismatch", err)
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("the paket is changed by a failed Rekey")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*.tmp")); len(matches) != 0 {
+		t.Errorf("temporary files are left: %v", matches)
+	}
+
+	if _, err := Rekey(Option{Key: []byte("wrong key"), PaketFile: path}, WriterOption{Key: []byte("new key")}, path); err == nil {
+		t.Error("Rekey accepted a wrong key")
+	}
+}
+
+func TestRewrapKeySlot(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM, Envelope: true}, testFiles)
+	dst := filepath.Join(t.TempDir(), "rewrapped.pack")
+	if err := RewrapKeySlot(Option{Key: []byte("test key"), PaketFile: path}, []byte("new key"), KDF{}, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := New(Option{Key: []byte("new key"), PaketFile: dst})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	checkTestFiles(t, p)
+	if _, err := New(Option{Key: []byte("test key"), PaketFile: dst}); err == nil {
+		t.Error("the rewrapped paket is opened with the old key")
+	}
+	// the source keeps its slot.
+	checkTestFiles(t, openTestPaket(t, path))
+}
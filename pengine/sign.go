@@ -0,0 +1,264 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+var (
+	// ErrNotSigned is returned by New when Option.TrustedKey is set and the paket has no signature.
+	ErrNotSigned = errors.New("paket is not signed")
+
+	// ErrInvalidSignature is returned by New when the signature of the paket is not made by Option.TrustedKey,
+	// or when the manifest was changed after signing.
+	ErrInvalidSignature = errors.New("invalid paket signature")
+)
+
+// manifestDomain is written before the signed manifest, so the signature cannot be used for anything else.
+const manifestDomain = "paket manifest v1\n"
+
+// manifest is everything that is signed: the parameters of the paket and the table values of every entry.
+// The entries are sorted by name, and the positions are relative to the start of the data,
+// so the signature stays valid when the header changes (see AddKeySlot).
+//
+// The fields are listed one by one instead of using Values, so a new field in Values does not change old signatures.
+type manifest struct {
+	Version uint16        `json:"version"`
+	Mode    MODE          `json:"mode"`
+	KDF     KDF           `json:"kdf"`
+	Salt    []byte        `json:"salt"`
+	Entries []manifestRow `json:"entries"`
+}
+
+type manifestRow struct {
+	Name             string      `json:"name"`
+	Start            int64       `json:"start"`
+	End              int64       `json:"end"`
+	OriginalLenght   int         `json:"originalLenght"`
+	EncryptLenght    int         `json:"encryptLenght"`
+	HashOriginal     []byte      `json:"hashOriginal"`
+	HashEncrypt      []byte      `json:"hashEncrypt"`
+	Nonce            []byte      `json:"nonce"`
+	ChunkSize        int         `json:"chunkSize"`
+	Compression      COMPRESSION `json:"compression"`
+	CompressedLenght int         `json:"compressedLenght"`
+	AAD              bool        `json:"aad,omitempty"`
+}
+
+// manifestBytes returns the bytes to sign. dataStart is the start of the data (0 for legacy files).
+// version is 0 for legacy files.
+func manifestBytes(version uint16, mode MODE, kdf KDF, salt []byte, table Datas, dataStart int64) ([]byte, error) {
+	m := manifest{Version: version, Mode: mode, KDF: kdf, Salt: salt, Entries: make([]manifestRow, 0, len(table))}
+	for name, v := range table {
+		m.Entries = append(m.Entries, manifestRow{
+			Name:             name,
+			Start:            int64(v.StartPos) - dataStart,
+			End:              int64(v.EndPos) - dataStart,
+			OriginalLenght:   v.OriginalLenght,
+			EncryptLenght:    v.EncryptLenght,
+			HashOriginal:     v.HashOriginal,
+			HashEncrypt:      v.HashEncrypt,
+			Nonce:            v.Nonce,
+			ChunkSize:        v.ChunkSize,
+			Compression:      v.Compression,
+			CompressedLenght: v.CompressedLenght,
+			AAD:              v.AAD,
+		})
+	}
+	sort.Slice(m.Entries, func(i, j int) bool {
+		return m.Entries[i].Name < m.Entries[j].Name
+	})
+	js, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(manifestDomain), js...), nil
+}
+
+// containerManifest returns the manifest of a container.
+func containerManifest(h Header, table Datas, dataStart int64) ([]byte, error) {
+	return manifestBytes(h.Version, h.Mode, h.KDF, h.Salt, table, dataStart)
+}
+
+// legacyManifest returns the manifest of a legacy file, with the same KDF as legacyKey.
+func (o Option) legacyManifest() ([]byte, error) {
+	return manifestBytes(0, o.Mode, o.legacyKDF(), []byte(o.Salt), o.Table, 0)
+}
+
+// verifyManifest checks that signature is made by trusted. signer is the public key written with the signature, if any.
+func verifyManifest(trusted, signer, signature, m []byte) error {
+	if len(signature) == 0 {
+		return ErrNotSigned
+	}
+	if len(trusted) != ed25519.PublicKeySize || len(signature) != ed25519.SignatureSize {
+		return ErrInvalidSignature
+	}
+	if signer != nil && !bytes.Equal(signer, trusted) {
+		return ErrInvalidSignature
+	}
+	if !ed25519.Verify(ed25519.PublicKey(trusted), m, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// signManifest signs m. privateKey is a 64 byte Ed25519 private key.
+func signManifest(privateKey, m []byte) ([]byte, error) {
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("ed25519 private key must be 64 bytes")
+	}
+	return ed25519.Sign(ed25519.PrivateKey(privateKey), m), nil
+}
+
+// GenerateEd25519Key creates a new key pair for signing pakets (see Sign and Option.TrustedKey).
+// Keep privateKey on the build machine, publicKey is compiled into the programs that open the pakets.
+func GenerateEd25519Key() (publicKey, privateKey []byte, err error) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return public, private, nil
+}
+
+// Sign signs the manifest of a paket with an Ed25519 private key.
+// The manifest is every value in the table (names, positions, lengths, hashes, nonces)
+// and the parameters of the paket (mode, KDF, salt).
+// The encrypted data is not signed itself, it is bound to the signature by its hash in the table (Values.HashEncrypt).
+// New with Option.TrustedKey opens the paket only if its table is signed by the private key,
+// and the read methods (GetFile, OpenFile, GetRange, the io/fs methods) check the hash of the encrypted data of an entry
+// before they use it. So an entry changed by someone without the private key is not read,
+// even if they know the encryption key.
+//
+// The file is written again with the new index and renamed over the old one, the old file is kept if there is an error.
+//
+// o opens the paket like New. For a container, the signature is written to its encrypted index, next to the table.
+// For a legacy file, the signature is returned and must be saved with the Go table, and passed as Option.Signature.
+//
+// Changing the entries (Editor, Compact, Rekey) removes the signature of a container, the paket must be signed again.
+// Changing the key slots keeps it.
+func Sign(o Option, privateKey []byte) ([]byte, error) {
+	if o.Table != nil {
+		m, err := o.legacyManifest()
+		if err != nil {
+			return nil, err
+		}
+		return signManifest(privateKey, m)
+	}
+
+	f, err := os.Open(o.PaketFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fInfo, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	h, dataStart, err := readHeader(f, fInfo.Size())
+	if err != nil {
+		return nil, err
+	}
+	key, err := o.containerKey(h)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := readIndex(f, fInfo.Size(), dataStart, key)
+	if err != nil {
+		return nil, err
+	}
+	offset, _, err := readFooter(f, fInfo.Size(), dataStart)
+	if err != nil {
+		return nil, err
+	}
+	head, err := readHead(f, dataStart)
+	if err != nil {
+		return nil, err
+	}
+	m, err := containerManifest(h, idx.Entries, dataStart)
+	if err != nil {
+		return nil, err
+	}
+	idx.Signature, err = signManifest(privateKey, m)
+	if err != nil {
+		return nil, err
+	}
+	idx.Signer = ed25519.PrivateKey(privateKey).Public().(ed25519.PublicKey)
+
+	// the file is written again with the new index, the old file is kept if there is an error.
+	tail, err := sealIndex(key, head, idx, offset)
+	if err != nil {
+		return nil, err
+	}
+	err = replaceFile(o.PaketFile, fInfo.Mode(), func(tmp *os.File) error {
+		if _, err := io.Copy(tmp, io.NewSectionReader(f, 0, offset)); err != nil {
+			return err
+		}
+		_, err := tmp.Write(tail)
+		return err
+	}, f.Close)
+	if err != nil {
+		return nil, err
+	}
+	return idx.Signature, nil
+}
+
+// trustedReadSize is the size of the pieces read by checkTrusted.
+const trustedReadSize = 1 << 20
+
+// checkTrusted checks the hash of the encrypted data of the entry against the signed table, for the pakets opened with Option.TrustedKey.
+// The signature covers the table, this check binds the data of the entry to it. The data is read in pieces, it is not kept.
+// Every entry is checked once, at its first read. The read lock must be held.
+func (p *Paket) checkTrusted(name string, v Values) error {
+	if !p.trusted {
+		return nil
+	}
+	if _, found := p.verified.Load(name); found {
+		return nil
+	}
+	h := sha256.New()
+	for off := 0; off < v.EncryptLenght; off += trustedReadSize {
+		length := v.EncryptLenght - off
+		if length > trustedReadSize {
+			length = trustedReadSize
+		}
+		content, err := p.readEncrypted(v, int64(off), length)
+		if err != nil {
+			return err
+		}
+		h.Write(content)
+	}
+	return p.checkTrustedSum(name, v, h.Sum(nil))
+}
+
+// checkTrustedData is checkTrusted for the encrypted data that is already read.
+func (p *Paket) checkTrustedData(name string, v Values, content []byte) error {
+	if !p.trusted {
+		return nil
+	}
+	if _, found := p.verified.Load(name); found {
+		return nil
+	}
+	sum := sha256.Sum256(content)
+	return p.checkTrustedSum(name, v, sum[:])
+}
+
+// checkTrustedSum compares the hash of the encrypted data with the signed hash, and keeps the entry as checked.
+func (p *Paket) checkTrustedSum(name string, v Values, sum []byte) error {
+	if !bytes.Equal(sum, v.HashEncrypt) {
+		return fmt.Errorf("%w: %s", ErrHashMismatch, name)
+	}
+	p.verified.Store(name, struct{}{})
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestSignedEntryChanged(t *testing.T) {
+	public, private, err := GenerateEd25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range testModes {
+		path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: mode, SigningKey: private}, testFiles)
+		o := Option{Key: []byte("test key"), PaketFile: path, TrustedKey: public}
+		p, err := New(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := p.table["ui/img/logo.bin"]
+		p.Close()
+
+		// the same key can write any data, only the hash in the signed table stops it.
+		corruptEntry(t, path, v)
+		p, err = New(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := p.GetFile("ui/img/logo.bin", false, false); !errors.Is(err, ErrHashMismatch) {
+			t.Errorf("%v GetFile: %v", mode, err)
+		}
+		if _, err := p.GetRange("ui/img/logo.bin", 0, 10); !errors.Is(err, ErrHashMismatch) {
+			t.Errorf("%v GetRange: %v", mode, err)
+		}
+		if _, err := p.Open("ui/img/logo.bin"); !errors.Is(err, ErrHashMismatch) {
+			t.Errorf("%v Open: %v", mode, err)
+		}
+		if _, err := p.GetRange("readme.txt", 0, 5); err != nil {
+			t.Errorf("%v other entry: %v", mode, err)
+		}
+		p.Close()
+	}
+}
+
+func TestSignKeepsFileOnError(t *testing.T) {
+	_, private, err := GenerateEd25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM}, testFiles)
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Sign(Option{Key: []byte("test key"), PaketFile: path}, private[:10]); err == nil {
+		t.Fatal("short private key is accepted")
+	}
+	if _, err := Sign(Option{Key: []byte("wrong key"), PaketFile: path}, private); err == nil {
+		t.Fatal("wrong key is accepted")
+	}
+	after, _ := os.ReadFile(path)
+	if string(before) != string(after) {
+		t.Fatal("the file is changed")
+	}
+	if _, err := Sign(Option{Key: []byte("test key"), PaketFile: path}, private); err != nil {
+		t.Fatal(err)
+	}
+	p := openTestPaket(t, path)
+	f, err := p.Open("ui/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(f); err != nil || string(data) != string(testFiles["ui/index.html"]) {
+		t.Fatal(err)
+	}
+}
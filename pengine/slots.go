@@ -0,0 +1,324 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+var (
+	// ErrNoKeySlots is returned by the key slot functions for a paket that was created without key slots.
+	ErrNoKeySlots = errors.New("paket has no key slots, it must be created with WriterOption.Envelope")
+
+	// ErrKeySlotNotFound is returned when there is no key slot with the name.
+	ErrKeySlotNotFound = errors.New("key slot not found")
+)
+
+// defaultSlotName is the name of the key slot of WriterOption.Key, created by NewWriter.
+const defaultSlotName = "default"
+
+// KeySlot keeps the data key of a paket, encrypted (wrapped) with a key derived from a password or with a raw key.
+//
+// A paket with key slots (see WriterOption.Envelope) encrypts its entries and its index with a random data key.
+// Every slot can open the data key, so the paket can be opened with any of their passwords.
+// Slots can be added and removed without encrypting the entries again (AddKeySlot, RemoveKeySlot).
+//
+// Slots are written to the plain header. They are safe to be seen: the data key in them is sealed with AES-GCM.
+type KeySlot struct {
+	// unique name of the slot, like "ci" or "team-audio".
+	Name string `json:"name"`
+
+	// KDF of the password of this slot. KDFRAW for a raw 32 byte key, KDFX25519 for a Recipient.
+	KDF KDF `json:"kdf"`
+
+	// random salt for the KDF. The ephemeral public key for a recipient slot.
+	Salt []byte `json:"salt"`
+
+	// X25519 public key of the recipient, so the slot is found without trying the others.
+	// Only for the recipient slots.
+	Recipient []byte `json:"recipient,omitempty"`
+
+	// 12 byte nonce and the data key sealed with AES-GCM.
+	Nonce []byte `json:"nonce"`
+	Key   []byte `json:"key"`
+}
+
+// KeySlotInfo is the public part of a key slot, returned by KeySlots.
+type KeySlotInfo struct {
+	Name string
+	KDF  KDF
+
+	// X25519 public key of a recipient slot. nil for the other slots.
+	Recipient []byte
+}
+
+// newKeySlot wraps dek with the key derived from key.
+// o.Pipeline is used if kdf is KDFPIPELINE.
+func newKeySlot(o Option, name string, key []byte, kdf KDF, dek []byte) (KeySlot, error) {
+	if name == "" {
+		return KeySlot{}, errors.New("key slot name cannot be empty")
+	}
+	if len(key) == 0 {
+		return KeySlot{}, errors.New("key cannot be empty")
+	}
+	// the zero KDF is PBKDF2, like in WriterOption.
+	kdf = WriterOption{KDF: kdf}.kdf()
+	if err := kdf.checkStored(); err != nil {
+		return KeySlot{}, err
+	}
+	slot := KeySlot{Name: name, KDF: kdf}
+	var err error
+	if kdf.Algorithm != KDFRAW {
+		slot.Salt, err = CreateRandomBytes(32)
+		if err != nil {
+			return KeySlot{}, err
+		}
+	}
+	o.Key = key
+	slotKey, err := o.deriveKey(kdf, slot.Salt)
+	if err != nil {
+		return KeySlot{}, err
+	}
+	nonce, err := CreateRandomBytes(16)
+	if err != nil {
+		return KeySlot{}, err
+	}
+	slot.Nonce = nonce[:12]
+	slot.Key, err = Encrypt(slotKey, slot.Nonce, dek, MODEGCM)
+	if err != nil {
+		return KeySlot{}, err
+	}
+	return slot, nil
+}
+
+// openKeySlots returns the data key and the index of the slot that opened it.
+// If o.KeySlot is set, only that slot is tried. Otherwise all slots are tried in order.
+// The recipient slots are opened with o.Identity, the others with o.Key.
+func openKeySlots(o Option, slots []KeySlot) ([]byte, int, error) {
+	found, recipients := false, false
+	for i, slot := range slots {
+		if o.KeySlot != "" && slot.Name != o.KeySlot {
+			continue
+		}
+		found = true
+		var slotKey []byte
+		if slot.KDF.Algorithm == KDFX25519 {
+			recipients = true
+			if o.Identity == nil {
+				continue
+			}
+			key, ok, err := recipientKey(o.Identity, slot)
+			if err != nil {
+				return nil, 0, err
+			}
+			if !ok {
+				continue
+			}
+			slotKey = key
+		} else {
+			if len(o.Key) == 0 {
+				continue
+			}
+			if err := slot.KDF.checkStored(); err != nil {
+				return nil, 0, err
+			}
+			key, err := o.deriveKey(slot.KDF, slot.Salt)
+			if err != nil {
+				// a raw slot cannot be opened with a password of another length. Try the next slot.
+				if slot.KDF.Algorithm == KDFRAW {
+					continue
+				}
+				return nil, 0, err
+			}
+			slotKey = key
+		}
+		dek, err := Decrypt(slotKey, slot.Nonce, slot.Key, MODEGCM)
+		if err == nil {
+			return dek, i, nil
+		}
+	}
+	if !found {
+		return nil, 0, ErrKeySlotNotFound
+	}
+	if recipients && o.Identity == nil {
+		return nil, 0, ErrIdentityRequired
+	}
+	return nil, 0, ErrInvalidKey
+}
+
+// containerKey returns the key of the entries and the index of a container:
+// the data key from the key slots, or the key derived from o.Key with the KDF in the header.
+func (o Option) containerKey(h Header) ([]byte, error) {
+	if len(h.Slots) > 0 {
+		dek, _, err := openKeySlots(o, h.Slots)
+		return dek, err
+	}
+	if err := h.KDF.checkStored(); err != nil {
+		return nil, err
+	}
+	return o.deriveKey(h.KDF, h.Salt)
+}
+
+// KeySlots returns the names and the KDFs of the key slots of a container file.
+// No key is needed, the slots are in the plain header.
+// Returns ErrNoKeySlots if the paket was created without key slots.
+func KeySlots(path string) ([]KeySlotInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fInfo, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	h, _, err := readHeader(f, fInfo.Size())
+	if err != nil {
+		return nil, err
+	}
+	if len(h.Slots) == 0 {
+		return nil, ErrNoKeySlots
+	}
+	infos := make([]KeySlotInfo, len(h.Slots))
+	for i, slot := range h.Slots {
+		infos[i] = KeySlotInfo{Name: slot.Name, KDF: slot.KDF, Recipient: slot.Recipient}
+	}
+	return infos, nil
+}
+
+// AddKeySlot adds a new key slot to the container file o.PaketFile.
+// o opens the paket like New, with the key of an existing slot. key and kdf are the new key and its KDF.
+// For a raw key (KDFRAW), key must be 32 bytes.
+//
+// The entries are not encrypted again. The file is rewritten because the header gets longer (see RemoveKeySlot).
+func AddKeySlot(o Option, name string, key []byte, kdf KDF) error {
+	return rewriteHeader(o, o.PaketFile, func(h *Header, dek []byte, opened int) error {
+		for _, slot := range h.Slots {
+			if slot.Name == name {
+				return errors.New("there is already a key slot with this name: " + name)
+			}
+		}
+		slot, err := newKeySlot(o, name, key, kdf, dek)
+		if err != nil {
+			return err
+		}
+		h.Slots = append(h.Slots, slot)
+		return nil
+	})
+}
+
+// RemoveKeySlot removes a key slot from the container file o.PaketFile. The last slot cannot be removed.
+// o opens the paket like New, with the key of any slot (it can be the removed slot).
+//
+// The password of the removed slot cannot open the paket anymore. But the data key does not change:
+// if the data key itself may be known (for example from a memory dump of a running program), use Rekey to encrypt the entries again.
+//
+// The entries are not encrypted again. The file is written to a temporary file next to it and renamed,
+// because the positions of the entries change with the header length.
+func RemoveKeySlot(o Option, name string) error {
+	return rewriteHeader(o, o.PaketFile, func(h *Header, dek []byte, opened int) error {
+		for i, slot := range h.Slots {
+			if slot.Name != name {
+				continue
+			}
+			if len(h.Slots) == 1 {
+				return errors.New("the last key slot cannot be removed")
+			}
+			h.Slots = append(h.Slots[:i:i], h.Slots[i+1:]...)
+			return nil
+		}
+		return ErrKeySlotNotFound
+	})
+}
+
+// RewrapKeySlot replaces the key of the slot opened by o with a new key and KDF.
+// A recipient slot (opened with o.Identity) becomes a password slot with the same name.
+// Only the data key is encrypted again, the entries are not. It is the fast Rekey for pakets with key slots.
+//
+// The new paket is written to dst (it can be o.PaketFile), with a temporary file and rename.
+func RewrapKeySlot(o Option, key []byte, kdf KDF, dst string) error {
+	return rewriteHeader(o, dst, func(h *Header, dek []byte, opened int) error {
+		slot, err := newKeySlot(o, h.Slots[opened].Name, key, kdf, dek)
+		if err != nil {
+			return err
+		}
+		h.Slots[opened] = slot
+		return nil
+	})
+}
+
+// rewriteHeader opens a container with key slots, changes its header and writes it to dst.
+// change gets the data key and the index of the slot that opened it.
+//
+// The entry data is copied as it is (with the dead space). The positions in the index are moved
+// by the change of the header length, and the index is sealed again with the data key.
+func rewriteHeader(o Option, dst string, change func(h *Header, dek []byte, opened int) error) error {
+	src, err := os.Open(o.PaketFile)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fInfo, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	size := fInfo.Size()
+
+	h, dataStart, err := readHeader(src, size)
+	if err != nil {
+		return err
+	}
+	if len(h.Slots) == 0 {
+		return ErrNoKeySlots
+	}
+	dek, opened, err := openKeySlots(o, h.Slots)
+	if err != nil {
+		return err
+	}
+	idx, err := readIndex(src, size, dataStart, dek)
+	if err != nil {
+		return err
+	}
+	indexOffset, _, err := readFooter(src, size, dataStart)
+	if err != nil {
+		return err
+	}
+
+	h.Slots = append([]KeySlot(nil), h.Slots...)
+	if err := change(&h, dek, opened); err != nil {
+		return err
+	}
+	head, err := encodeHeader(h)
+	if err != nil {
+		return err
+	}
+	delta := int64(len(head)) - dataStart
+
+	// the signature stays valid: it covers the positions relative to the start of the data.
+	newTable := make(Datas, len(idx.Entries))
+	for name, v := range idx.Entries {
+		v.StartPos += int(delta)
+		v.EndPos += int(delta)
+		newTable[name] = v
+	}
+	idx.Entries = newTable
+	tail, err := sealIndex(dek, head, idx, indexOffset+delta)
+	if err != nil {
+		return err
+	}
+	return replaceFile(dst, fInfo.Mode(), func(tmp *os.File) error {
+		if _, err := tmp.Write(head); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tmp, io.NewSectionReader(src, dataStart, indexOffset-dataStart)); err != nil {
+			return err
+		}
+		_, err := tmp.Write(tail)
+		return err
+	}, src.Close)
+}
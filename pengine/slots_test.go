@@ -0,0 +1,140 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"errors"
+	"testing"
+)
+
+// slotNames returns the names of the key slots of the container at path.
+func slotNames(t *testing.T, path string) []string {
+	t.Helper()
+	infos, err := KeySlots(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name
+	}
+	return names
+}
+
+func TestKeySlots(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM, Envelope: true}, testFiles)
+	o := Option{Key: []byte("test key"), PaketFile: path}
+	if err := AddKeySlot(o, "backup", []byte("backup key"), KDF{Algorithm: KDFSCRYPT, N: 1 << 10, R: 8, P: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddKeySlot(o, "backup", []byte("other key"), KDF{}); err == nil {
+		t.Error("a second slot with the same name is added")
+	}
+	if got := slotNames(t, path); len(got) != 2 || got[0] != defaultSlotName || got[1] != "backup" {
+		t.Fatalf("slots: %v", got)
+	}
+
+	// every slot opens the paket.
+	for _, key := range []string{"test key", "backup key"} {
+		p, err := New(Option{Key: []byte(key), PaketFile: path})
+		if err != nil {
+			t.Fatalf("%s: %v", key, err)
+		}
+		checkTestFiles(t, p)
+		p.Close()
+	}
+
+	// Option.KeySlot only tries the named slot.
+	if _, err := New(Option{Key: []byte("backup key"), PaketFile: path, KeySlot: defaultSlotName}); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("key of another slot: %v, want ErrInvalidKey", err)
+	}
+	if _, err := New(Option{Key: []byte("backup key"), PaketFile: path, KeySlot: "missing"}); !errors.Is(err, ErrKeySlotNotFound) {
+		t.Errorf("missing slot: %v, want ErrKeySlotNotFound", err)
+	}
+	p, err := New(Option{Key: []byte("backup key"), PaketFile: path, KeySlot: "backup"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+
+	// the removed key cannot open the paket, the other slot still does.
+	if err := RemoveKeySlot(Option{Key: []byte("backup key"), PaketFile: path}, defaultSlotName); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(o); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("removed key: %v, want ErrInvalidKey", err)
+	}
+	if err := RemoveKeySlot(Option{Key: []byte("backup key"), PaketFile: path}, "missing"); !errors.Is(err, ErrKeySlotNotFound) {
+		t.Errorf("removing a missing slot: %v, want ErrKeySlotNotFound", err)
+	}
+	if err := RemoveKeySlot(Option{Key: []byte("backup key"), PaketFile: path}, "backup"); err == nil {
+		t.Error("the last slot is removed")
+	}
+	p, err = New(Option{Key: []byte("backup key"), PaketFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	checkTestFiles(t, p)
+}
+
+func TestRawKeySlot(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEXCHACHA20POLY1305, Envelope: true}, testFiles)
+	raw := testRandom(32)
+	if err := AddKeySlot(Option{Key: []byte("test key"), PaketFile: path}, "raw", raw[:31], KDF{Algorithm: KDFRAW}); err == nil {
+		t.Error("a raw key of 31 bytes is accepted")
+	}
+	if err := AddKeySlot(Option{Key: []byte("test key"), PaketFile: path}, "raw", raw, KDF{Algorithm: KDFRAW}); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := KeySlots(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if infos[1].KDF.Algorithm != KDFRAW {
+		t.Errorf("KDF of the raw slot: %v", infos[1].KDF)
+	}
+
+	p, err := New(Option{Key: raw, PaketFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	checkTestFiles(t, p)
+	// the password of the other slot does not fit the raw slot, it is skipped.
+	checkTestFiles(t, openTestPaket(t, path))
+}
+
+func TestKeySlotsWithoutEnvelope(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM}, testFiles)
+	if _, err := KeySlots(path); !errors.Is(err, ErrNoKeySlots) {
+		t.Errorf("KeySlots: %v, want ErrNoKeySlots", err)
+	}
+	if err := AddKeySlot(Option{Key: []byte("test key"), PaketFile: path}, "backup", []byte("backup key"), KDF{}); !errors.Is(err, ErrNoKeySlots) {
+		t.Errorf("AddKeySlot: %v, want ErrNoKeySlots", err)
+	}
+}
+
+// the signature does not cover the key slots, they can be changed without the signing key.
+func TestKeySlotsKeepSignature(t *testing.T) {
+	public, private, err := GenerateEd25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM, Envelope: true, SigningKey: private}, testFiles)
+	if err := AddKeySlot(Option{Key: []byte("test key"), PaketFile: path}, "a much longer name for the backup slot", []byte("backup key"), KDF{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveKeySlot(Option{Key: []byte("backup key"), PaketFile: path}, defaultSlotName); err != nil {
+		t.Fatal(err)
+	}
+	p, err := New(Option{Key: []byte("backup key"), PaketFile: path, TrustedKey: public})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	checkTestFiles(t, p)
+}
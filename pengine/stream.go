@@ -0,0 +1,640 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// DefaultChunkSize is the chunk size used by Writer for the authenticated modes.
+//
+// In the authenticated modes (GCM, ChaCha20-Poly1305, XChaCha20-Poly1305) an entry is not sealed as one block.
+// It is split into chunks and every chunk is sealed on its own, so a chunk can be checked
+// before its bytes are returned. This is what makes streaming and seeking possible for these modes.
+const DefaultChunkSize = 64 * 1024
+
+// ErrChunk is returned when a chunk of an entry cannot be authenticated.
+var ErrChunk = errors.New("chunk authentication failed")
+
+// isAEAD reports whether the mode has embedded authentication.
+func isAEAD(mode MODE) bool {
+	return mode == MODEGCM || mode == MODECHACHA20POLY1305 || mode == MODEXCHACHA20POLY1305
+}
+
+// newAEAD creates the AEAD cipher for the authenticated modes.
+func newAEAD(key []byte, mode MODE) (cipher.AEAD, error) {
+	switch mode {
+	case MODEGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case MODECHACHA20POLY1305:
+		return chacha20poly1305.New(key)
+	case MODEXCHACHA20POLY1305:
+		return chacha20poly1305.NewX(key)
+	default:
+		return nil, ErrInvalidMode
+	}
+}
+
+// NonceSize returns the length of the nonce that must be passed to Encrypt for the mode.
+// It is 0 for the modes that do not use a nonce (they use a random IV instead).
+func NonceSize(mode MODE) int {
+	switch mode {
+	case MODEGCM:
+		return 12
+	case MODECHACHA20POLY1305:
+		return chacha20poly1305.NonceSize
+	case MODEXCHACHA20POLY1305:
+		return chacha20poly1305.NonceSizeX
+	default:
+		return 0
+	}
+}
+
+// chunkCount returns the number of chunks for an entry of the given length.
+// There is always at least one chunk, also for empty entries.
+func chunkCount(length, chunkSize int) int64 {
+	if length == 0 {
+		return 1
+	}
+	return int64((length + chunkSize - 1) / chunkSize)
+}
+
+// chunkNonce returns the nonce of the i. chunk.
+// The counter is XORed into the last 8 bytes of the entry nonce.
+func chunkNonce(base []byte, i int64) []byte {
+	nonce := make([]byte, len(base))
+	copy(nonce, base)
+	var ctr [8]byte
+	binary.BigEndian.PutUint64(ctr[:], uint64(i))
+	for j := range ctr {
+		nonce[len(nonce)-8+j] ^= ctr[j]
+	}
+	return nonce
+}
+
+// chunkAD is the additional data of a chunk: the additional data of the entry (see AssociatedData) and a final byte.
+// The last chunk is marked, so a truncated entry cannot be authenticated.
+func chunkAD(ad []byte, final bool) []byte {
+	out := make([]byte, len(ad), len(ad)+1)
+	copy(out, ad)
+	if final {
+		return append(out, 1)
+	}
+	return append(out, 0)
+}
+
+// sealChunks encrypts data as a sequence of chunks with an authenticated mode.
+// ad is the additional data of the entry, nil for none.
+func sealChunks(key, nonce, data, ad []byte, mode MODE, chunkSize int) ([]byte, error) {
+	aead, err := newAEAD(key, mode)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce length")
+	}
+	count := chunkCount(len(data), chunkSize)
+	out := make([]byte, 0, len(data)+int(count)*aead.Overhead())
+	for i := int64(0); i < count; i++ {
+		start := int(i) * chunkSize
+		end := start + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		out = aead.Seal(out, chunkNonce(nonce, i), data[start:end], chunkAD(ad, i == count-1))
+	}
+	return out, nil
+}
+
+// openChunks decrypts and authenticates all chunks of an entry.
+func openChunks(key, nonce, data, ad []byte, mode MODE, chunkSize int) ([]byte, error) {
+	aead, err := newAEAD(key, mode)
+	if err != nil {
+		return nil, err
+	}
+	sealedSize := chunkSize + aead.Overhead()
+	count := int64((len(data) + sealedSize - 1) / sealedSize)
+	if count == 0 {
+		return nil, ErrShortData
+	}
+	out := make([]byte, 0, len(data)-int(count)*aead.Overhead())
+	for i := int64(0); i < count; i++ {
+		start := int(i) * sealedSize
+		end := start + sealedSize
+		if end > len(data) {
+			end = len(data)
+		}
+		out, err = aead.Open(out, chunkNonce(nonce, i), data[start:end], chunkAD(ad, i == count-1))
+		if err != nil {
+			return nil, ErrChunk
+		}
+	}
+	return out, nil
+}
+
+// decrypt decrypts the content of an entry, chunked or not, and decompresses it.
+func (p *Paket) decrypt(name string, v Values, content []byte) ([]byte, error) {
+	stored, err := p.decryptStored(name, v, content)
+	if err != nil || v.Compression == COMPRESSNONE {
+		return stored, err
+	}
+	return decompress(stored, v.Compression, v.OriginalLenght)
+}
+
+// decryptStored decrypts the content of an entry, chunked or not.
+// Compressed entries are returned compressed.
+func (p *Paket) decryptStored(name string, v Values, content []byte) ([]byte, error) {
+	ad := p.entryAD(name, v)
+	key := p.entryKey(name)
+	if v.ChunkSize > 0 {
+		return openChunks(key, v.Nonce, content, ad, p.mode, v.ChunkSize)
+	}
+	return DecryptWithAD(key, v.Nonce, content, ad, p.mode)
+}
+
+// entryAD returns the additional data of the entry, or nil for a legacy entry written without it.
+// The entries of a container always have it.
+func (p *Paket) entryAD(name string, v Values) []byte {
+	if p.header != nil {
+		return AssociatedData(p.header.Version, p.header.ID, name)
+	}
+	if !v.AAD {
+		return nil
+	}
+	return AssociatedData(0, p.id, name)
+}
+
+// storedLenght returns the length of the data before encryption.
+// It is the compressed length for the compressed entries.
+func (v Values) storedLenght() int {
+	if v.Compression != COMPRESSNONE {
+		return v.CompressedLenght
+	}
+	return v.OriginalLenght
+}
+
+// File is an entry opened for streaming. It should be created with OpenFile (or Open).
+//
+// The data is read and decrypted on demand, the whole entry is never loaded into memory.
+// There are two exceptions: CBC entries, their HMAC covers the whole entry,
+// and the entries of authenticated modes written without chunks (legacy tables). These are decrypted at the first Read.
+//
+// In the authenticated modes every chunk is checked before its bytes are returned.
+// The other modes have no authentication, nothing is checked while reading.
+// Use GetFile with shaControl if you need the hash check for these modes.
+//
+// Compressed entries are decompressed while reading. Seeking back and ReadAt
+// have to decompress from the start of the entry for these entries.
+//
+// File is an io.ReadSeekCloser and an io.ReaderAt.
+// Read and Seek must not be used from several goroutines at the same time. ReadAt can.
+type File struct {
+	p    *Paket
+	name string
+	v    Values
+	pos  int64
+
+	// chunk size of the stored (decrypted but not decompressed) data.
+	// For the entries that are not chunked it is the length of the entry (one chunk).
+	chunkSize int
+
+	// last chunk decrypted by Read.
+	chunk      []byte
+	chunkIndex int64
+
+	// key stream used by Read for the stream modes, and its position.
+	stream    cipher.Stream
+	streamPos int64
+
+	// decompressor used by Read for the compressed entries, and its position.
+	dec    io.ReadCloser
+	decPos int64
+
+	closed bool
+}
+
+// OpenFile opens the named entry for streaming.
+//
+// Unlike GetFile, nothing is read until the first Read.
+func (p *Paket) OpenFile(name string) (*File, error) {
+	if err := p.rlock(); err != nil {
+		return nil, err
+	}
+	v, found := p.table[name]
+	var err error
+	if found {
+		err = p.checkTrusted(name, v)
+	}
+	p.mu.RUnlock()
+	if !found {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	f := &File{p: p, name: name, v: v, chunkIndex: -1}
+	switch {
+	case v.ChunkSize > 0:
+		if !isAEAD(p.mode) {
+			return nil, ErrInvalidMode
+		}
+		f.chunkSize = v.ChunkSize
+	case isAEAD(p.mode) || p.mode == MODECBC:
+		// one chunk, the whole entry.
+		f.chunkSize = v.storedLenght()
+	case p.mode == MODECFB || p.mode == MODECTR || p.mode == MODEOFB:
+		if v.EncryptLenght != v.storedLenght()+aes.BlockSize {
+			return nil, ErrShortData
+		}
+	default:
+		return nil, ErrInvalidMode
+	}
+	return f, nil
+}
+
+// Stat returns the information of the entry.
+func (f *File) Stat() (fs.FileInfo, error) {
+	return fileInfo{name: path.Base(f.name), v: f.v}, nil
+}
+
+// Read reads the next decrypted bytes of the entry.
+func (f *File) Read(b []byte) (int, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	if err := f.p.rlock(); err != nil {
+		return 0, err
+	}
+	defer f.p.mu.RUnlock()
+	if f.v.Compression != COMPRESSNONE {
+		return f.readCompressed(b)
+	}
+	n, err := f.readStored(b, f.pos, true)
+	f.pos += int64(n)
+	return n, err
+}
+
+// ReadAt reads the decrypted bytes starting at off.
+// It does not change the position of Read.
+func (f *File) ReadAt(b []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if err := f.p.rlock(); err != nil {
+		return 0, err
+	}
+	defer f.p.mu.RUnlock()
+	if f.v.Compression != COMPRESSNONE {
+		return f.readCompressedAt(b, off)
+	}
+	return f.readStored(b, off, false)
+}
+
+// Seek sets the position of the next Read, in the decrypted data.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += int64(f.v.OriginalLenght)
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+// Close releases the file. It does not close the Paket.
+func (f *File) Close() error {
+	if f.closed {
+		return fs.ErrClosed
+	}
+	f.closed = true
+	f.chunk = nil
+	f.stream = nil
+	if f.dec != nil {
+		f.dec.Close()
+		f.dec = nil
+	}
+	return nil
+}
+
+// readCompressed reads the next decompressed bytes.
+// The decompressor is kept between the calls. Seeking back creates a new one.
+func (f *File) readCompressed(b []byte) (int, error) {
+	size := int64(f.v.OriginalLenght)
+	if f.pos >= size {
+		return 0, io.EOF
+	}
+	if int64(len(b)) > size-f.pos {
+		b = b[:size-f.pos]
+	}
+
+	if f.dec == nil || f.decPos > f.pos {
+		if f.dec != nil {
+			f.dec.Close()
+		}
+		dec, err := newDecompressor(&storedReader{f: f, keep: true}, f.v.Compression)
+		if err != nil {
+			return 0, err
+		}
+		f.dec, f.decPos = dec, 0
+	}
+	if skip := f.pos - f.decPos; skip > 0 {
+		n, err := io.CopyN(ioutil.Discard, f.dec, skip)
+		f.decPos += n
+		if err != nil {
+			return 0, ErrDecompress
+		}
+	}
+
+	n, err := io.ReadFull(f.dec, b)
+	f.decPos += int64(n)
+	f.pos += int64(n)
+	if err != nil {
+		return n, ErrDecompress
+	}
+	return n, nil
+}
+
+// readCompressedAt decompresses the entry from the start with a new decompressor, up to off + len(b).
+func (f *File) readCompressedAt(b []byte, off int64) (int, error) {
+	size := int64(f.v.OriginalLenght)
+	if off >= size {
+		return 0, io.EOF
+	}
+	want := len(b)
+	if int64(want) > size-off {
+		b = b[:size-off]
+	}
+
+	dec, err := newDecompressor(&storedReader{f: f}, f.v.Compression)
+	if err != nil {
+		return 0, err
+	}
+	defer dec.Close()
+	if _, err := io.CopyN(ioutil.Discard, dec, off); err != nil {
+		return 0, ErrDecompress
+	}
+	n, err := io.ReadFull(dec, b)
+	if err != nil {
+		return n, ErrDecompress
+	}
+	if n < want {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// storedReader reads the stored data of a File from the start.
+// It is the input of the decompressor.
+type storedReader struct {
+	f    *File
+	off  int64
+	keep bool
+}
+
+func (r *storedReader) Read(b []byte) (int, error) {
+	n, err := r.f.readStored(b, r.off, r.keep)
+	r.off += int64(n)
+	return n, err
+}
+
+// readStored fills b from the position off of the stored data as much as possible.
+// If keep is true, the last decrypted chunk is kept for the next call.
+func (f *File) readStored(b []byte, off int64, keep bool) (int, error) {
+	size := int64(f.v.storedLenght())
+	if off >= size {
+		return 0, io.EOF
+	}
+	want := len(b)
+	if int64(want) > size-off {
+		b = b[:size-off]
+	}
+
+	var n int
+	var err error
+	if f.chunkSize > 0 {
+		n, err = f.readChunked(b, off, keep)
+	} else {
+		n, err = f.readStream(b, off, keep)
+	}
+	if err == nil && n < want {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// readChunked reads from the chunked (or single chunk) entries.
+func (f *File) readChunked(b []byte, off int64, keep bool) (int, error) {
+	n := 0
+	for n < len(b) {
+		i := (off + int64(n)) / int64(f.chunkSize)
+		var plain []byte
+		if f.chunk != nil && f.chunkIndex == i {
+			plain = f.chunk
+		} else {
+			var err error
+			plain, err = f.decryptChunk(i)
+			if err != nil {
+				return n, err
+			}
+			if keep {
+				f.chunk, f.chunkIndex = plain, i
+			}
+		}
+		inChunk := int(off + int64(n) - i*int64(f.chunkSize))
+		if inChunk >= len(plain) {
+			return n, ErrShortData
+		}
+		n += copy(b[n:], plain[inChunk:])
+	}
+	return n, nil
+}
+
+// decryptChunk reads and decrypts the i. chunk of the entry.
+func (f *File) decryptChunk(i int64) ([]byte, error) {
+	if f.v.ChunkSize == 0 {
+		content, err := f.p.readEncrypted(f.v, 0, f.v.EncryptLenght)
+		if err != nil {
+			return nil, err
+		}
+		return f.p.decryptStored(f.name, f.v, content)
+	}
+
+	aead, err := newAEAD(f.p.entryKey(f.name), f.p.mode)
+	if err != nil {
+		return nil, err
+	}
+	sealedSize := int64(f.chunkSize + aead.Overhead())
+	count := chunkCount(f.v.storedLenght(), f.chunkSize)
+	start := i * sealedSize
+	length := sealedSize
+	if i == count-1 {
+		length = int64(f.v.EncryptLenght) - start
+	}
+	if length < int64(aead.Overhead()) {
+		return nil, ErrShortData
+	}
+	content, err := f.p.readEncrypted(f.v, start, int(length))
+	if err != nil {
+		return nil, err
+	}
+	// not opened in place: content can be the read-only mapping of the file.
+	plain, err := aead.Open(nil, chunkNonce(f.v.Nonce, i), content, chunkAD(f.p.entryAD(f.name, f.v), i == count-1))
+	if err != nil {
+		return nil, ErrChunk
+	}
+	return plain, nil
+}
+
+// readStream reads from the entries of the stream modes (CFB, CTR, OFB).
+// Only the bytes that are needed are read from the file. The OFB mode needs to create
+// the key stream from the start, so seeking back is slow in this mode.
+//
+// If keep is true and off is where the last call ended, the key stream of the last call is used.
+func (f *File) readStream(b []byte, off int64, keep bool) (int, error) {
+	stream := f.stream
+	if !keep || stream == nil || off != f.streamPos {
+		var err error
+		stream, err = f.newStream(off)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	content, err := f.p.readEncrypted(f.v, int64(aes.BlockSize)+off, len(b))
+	if err != nil {
+		return 0, err
+	}
+	// decrypted into b, content can be the read-only mapping of the file.
+	stream.XORKeyStream(b[:len(content)], content)
+	if keep {
+		f.stream, f.streamPos = stream, off+int64(len(content))
+	}
+	return len(content), nil
+}
+
+// newStream creates the key stream of the entry, positioned at off.
+func (f *File) newStream(off int64) (cipher.Stream, error) {
+	block, err := aes.NewCipher(f.p.entryKey(f.name))
+	if err != nil {
+		return nil, err
+	}
+	iv, err := f.p.readEncrypted(f.v, 0, aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// position of the block in the encrypted data (after the IV).
+	blockStart := off - off%aes.BlockSize
+
+	var stream cipher.Stream
+	switch f.p.mode {
+	case MODECTR:
+		ctr := make([]byte, aes.BlockSize)
+		copy(ctr, iv)
+		addCounter(ctr, uint64(blockStart/aes.BlockSize))
+		stream = cipher.NewCTR(block, ctr)
+	case MODECFB:
+		// the IV of a CFB block is the previous encrypted block.
+		prev := iv
+		if blockStart > 0 {
+			prev, err = f.p.readEncrypted(f.v, blockStart, aes.BlockSize)
+			if err != nil {
+				return nil, err
+			}
+		}
+		stream = cipher.NewCFBDecrypter(block, prev)
+	case MODEOFB:
+		stream = cipher.NewOFB(block, iv)
+		blockStart = 0
+	default:
+		return nil, ErrInvalidMode
+	}
+
+	// move the stream from the start of the block to off.
+	// CFB needs the encrypted bytes for this, the others only the key stream.
+	if skip := off - blockStart; skip > 0 {
+		if f.p.mode == MODECFB {
+			head, err := f.p.readEncrypted(f.v, int64(aes.BlockSize)+blockStart, int(skip))
+			if err != nil {
+				return nil, err
+			}
+			stream.XORKeyStream(make([]byte, len(head)), head)
+			return stream, nil
+		}
+		discard := make([]byte, 32*1024)
+		for skip > 0 {
+			l := int64(len(discard))
+			if l > skip {
+				l = skip
+			}
+			stream.XORKeyStream(discard[:l], discard[:l])
+			skip -= l
+		}
+	}
+	return stream, nil
+}
+
+// addCounter adds n to the big endian counter block of the CTR mode.
+func addCounter(ctr []byte, n uint64) {
+	for i := len(ctr) - 1; i >= 0 && n > 0; i-- {
+		sum := uint64(ctr[i]) + n&0xff
+		ctr[i] = byte(sum)
+		n = n>>8 + sum>>8
+	}
+}
+
+// readEncrypted reads length bytes of the encrypted entry, starting at off in the entry.
+func (p *Paket) readEncrypted(v Values, off int64, length int) ([]byte, error) {
+	if off < 0 || off+int64(length) > int64(v.EncryptLenght) {
+		return nil, ErrShortData
+	}
+	pos := int64(v.StartPos) + off
+	if pos+int64(length) > p.size {
+		return nil, ErrTruncated
+	}
+	if p.mapped != nil {
+		// no copy. The caller holds the read lock, the mapping cannot be released while it is used.
+		return p.mapped[pos : pos+int64(length) : pos+int64(length)], nil
+	}
+	content := make([]byte, length)
+	// ReadAt does not use a shared position, many goroutines can read at the same time without a lock.
+	n, err := p.file.ReadAt(content, pos)
+	if n < length {
+		// a short read must never be returned as the data.
+		if err == nil || err == io.EOF {
+			err = ErrTruncated
+		}
+		return nil, err
+	}
+	// ReadAt can return io.EOF with all the data at the end of the file.
+	return content, nil
+}
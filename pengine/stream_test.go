@@ -0,0 +1,130 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/iotest"
+)
+
+func TestOpenFile(t *testing.T) {
+	for _, mode := range testModes {
+		for _, c := range testCompressions {
+			path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: mode, Compression: c, ChunkSize: 1000}, testFiles)
+			p := openTestPaket(t, path)
+			for name, want := range testFiles {
+				f, err := p.OpenFile(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, err := io.ReadAll(f); err != nil || !bytes.Equal(got, want) {
+					t.Fatalf("mode %d, compression %d, %s: ReadAll: %v", mode, c, name, err)
+				}
+				// iotest.TestReader checks Read, ReadAt and Seek against the content.
+				// ReadAt of a compressed or OFB entry starts from the start of the entry, it is too slow for the large ones.
+				if len(want) < 1000 || c == COMPRESSNONE && len(want) < 10000 {
+					if _, err := f.Seek(0, io.SeekStart); err != nil {
+						t.Fatal(err)
+					}
+					if err := iotest.TestReader(f, want); err != nil {
+						t.Errorf("mode %d, compression %d, %s: %v", mode, c, name, err)
+					}
+				}
+				f.Close()
+			}
+		}
+	}
+}
+
+func TestFileSeek(t *testing.T) {
+	want := testFiles["ui/img/logo.bin"]
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM, ChunkSize: 4096}, testFiles)
+	f, err := openTestPaket(t, path).OpenFile("ui/img/logo.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	b := make([]byte, 100)
+	seeks := []struct {
+		offset int64
+		whence int
+		pos    int64
+	}{
+		{4090, io.SeekStart, 4090}, // over the end of the first chunk
+		{-200, io.SeekEnd, int64(len(want)) - 200},
+		{-300, io.SeekCurrent, int64(len(want)) - 400},
+		{0, io.SeekStart, 0},
+	}
+	for _, s := range seeks {
+		pos, err := f.Seek(s.offset, s.whence)
+		if err != nil || pos != s.pos {
+			t.Fatalf("Seek(%d, %d): %d, %v, want %d", s.offset, s.whence, pos, err, s.pos)
+		}
+		if _, err := io.ReadFull(f, b); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, want[pos:pos+100]) {
+			t.Fatalf("wrong content after Seek(%d, %d)", s.offset, s.whence)
+		}
+	}
+
+	if _, err := f.Seek(-1, io.SeekStart); err == nil {
+		t.Error("negative position is accepted")
+	}
+	if _, err := f.Seek(10, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Read(b); n != 0 || err != io.EOF {
+		t.Errorf("Read after the end: %d, %v", n, err)
+	}
+	if _, err := f.ReadAt(b, -1); err == nil {
+		t.Error("ReadAt accepted a negative offset")
+	}
+
+	f.Close()
+	if _, err := f.Read(b); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("Read after Close: %v", err)
+	}
+	if err := f.Close(); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+// only the changed chunk fails to authenticate, the chunks before it are read.
+func TestOpenFileChangedChunk(t *testing.T) {
+	want := testFiles["ui/img/logo.bin"]
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODECHACHA20POLY1305, ChunkSize: 4096}, testFiles)
+	v, _ := openTestPaket(t, path).Entry("ui/img/logo.bin")
+	corruptEntry(t, path, v)
+
+	f, err := openTestPaket(t, path).OpenFile("ui/img/logo.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b := make([]byte, 4096)
+	if _, err := f.ReadAt(b, 0); err != nil || !bytes.Equal(b, want[:4096]) {
+		t.Fatalf("first chunk: %v", err)
+	}
+	if _, err := f.ReadAt(b, int64(len(want))-10); !errors.Is(err, ErrChunk) {
+		t.Errorf("last chunk: %v, want ErrChunk", err)
+	}
+	if _, err := io.ReadAll(f); !errors.Is(err, ErrChunk) {
+		t.Errorf("ReadAll: %v, want ErrChunk", err)
+	}
+}
+
+func TestOpenFileNotExist(t *testing.T) {
+	path := writeTestPaket(t, WriterOption{Key: []byte("test key"), Mode: MODEGCM}, testFiles)
+	if _, err := openTestPaket(t, path).OpenFile("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("OpenFile: %v, want fs.ErrNotExist", err)
+	}
+}
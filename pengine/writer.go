@@ -0,0 +1,298 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package pengine
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+)
+
+// WriterOption keeps the settings for a new container file.
+type WriterOption struct {
+	// Key value for encrypting the file's data.
+	// It is not written to the file.
+	Key []byte
+
+	// PBDFK2 iteration. For less than 4096, 4096 is used.
+	// Only used if KDF is not set.
+	Iteration uint
+
+	// key derivation function and its parameters. It is written to the header.
+	// If it is the zero value, PBKDF2 with Iteration is used.
+	KDF KDF
+
+	// key derivation pipeline. If it is set, KDF and Iteration are not used.
+	// Only the fact that a pipeline is used is written to the header, not the stages.
+	Pipeline *KeyDerivationPipeline
+
+	// encrypt/decrypt mode
+	Mode MODE
+
+	// Size of the chunks for the authenticated modes.
+	// If it is 0, DefaultChunkSize is used.
+	ChunkSize int
+
+	// Compression of the entries before encryption (see Compress).
+	// The files that do not get smaller, like png or zip, are written without compression.
+	Compression COMPRESSION
+
+	// Envelope encrypts the entries and the index with a random data key instead of the key derived from Key.
+	// The data key is written to the header in a key slot named "default", wrapped with the key derived from Key (see KeySlot).
+	// More keys can be added later with AddKeySlot, without encrypting the entries again.
+	Envelope bool
+
+	// X25519 public keys that can open the paket with their private keys (see Recipient).
+	// A key slot is written for each of them, like Envelope. Key can be empty: then only the recipients can open the paket,
+	// and the machine that creates it does not need any secret.
+	Recipients []Recipient
+
+	// Ed25519 private key (64 bytes) for signing the manifest in Close (see Sign). The paket is not signed if it is nil.
+	SigningKey []byte
+}
+
+// Writer creates a paket container file.
+// It should be created with NewWriter.
+//
+// Entries are encrypted and written as they are added.
+// The index is written by Close.
+type Writer struct {
+	w io.Writer
+
+	key []byte
+
+	header Header
+
+	// preamble and header as they are written, the associated data of the index.
+	head []byte
+
+	table Datas
+
+	// chunk size for the authenticated modes.
+	chunkSize int
+
+	compression COMPRESSION
+
+	// number of bytes written to w.
+	offset int
+
+	// start of the data, after the header. For the signed manifest.
+	dataStart int
+
+	signingKey []byte
+
+	closed bool
+}
+
+// kdf returns the KDF to write to the header: Iteration is used if KDF is not set,
+// and KDFPIPELINE if there is a pipeline.
+func (o WriterOption) kdf() KDF {
+	kdf := o.KDF
+	if kdf.Algorithm == 0 {
+		kdf = KDF{Algorithm: KDFPBKDF2, Iteration: o.Iteration}
+	}
+	if kdf.Algorithm == KDFPBKDF2 && kdf.Iteration < 4096 {
+		kdf.Iteration = 4096
+	}
+	if o.Pipeline != nil {
+		kdf = KDF{Algorithm: KDFPIPELINE}
+	}
+	return kdf
+}
+
+// NewWriter creates a new Writer and writes the container header to w.
+//
+// A random salt is created for every container.
+// Close must be called to write the index, otherwise the file cannot be opened.
+func NewWriter(w io.Writer, o WriterOption) (*Writer, error) {
+	switch o.Mode {
+	case MODECBC, MODECFB, MODECTR, MODEOFB, MODEGCM, MODECHACHA20POLY1305, MODEXCHACHA20POLY1305:
+	default:
+		return nil, ErrInvalidMode
+	}
+	o.KDF = o.kdf()
+	if err := o.KDF.checkStored(); err != nil {
+		return nil, err
+	}
+	salt, err := CreateRandomBytes(32)
+	if err != nil {
+		return nil, err
+	}
+	id, err := CreateRandomBytes(16)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.ChunkSize < 0 {
+		return nil, errors.New("negative chunk size")
+	}
+	if o.ChunkSize == 0 {
+		o.ChunkSize = DefaultChunkSize
+	}
+
+	if o.SigningKey != nil && len(o.SigningKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("ed25519 private key must be 64 bytes")
+	}
+
+	pw := &Writer{w: w, table: make(Datas), chunkSize: o.ChunkSize, compression: o.Compression, signingKey: o.SigningKey}
+	if o.Envelope || len(o.Recipients) > 0 {
+		pw.key, err = CreateRandomBytes(32)
+		if err != nil {
+			return nil, err
+		}
+		pw.header = Header{Version: FormatVersion, Mode: o.Mode, ID: id}
+		if len(o.Key) > 0 || len(o.Recipients) == 0 {
+			slot, err := newKeySlot(Option{Pipeline: o.Pipeline}, defaultSlotName, o.Key, o.KDF, pw.key)
+			if err != nil {
+				return nil, err
+			}
+			pw.header.Slots = append(pw.header.Slots, slot)
+		}
+		for _, r := range o.Recipients {
+			slot, err := newRecipientSlot(r, pw.key)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range pw.header.Slots {
+				if s.Name == slot.Name {
+					return nil, errors.New("duplicate key slot name: " + slot.Name)
+				}
+			}
+			pw.header.Slots = append(pw.header.Slots, slot)
+		}
+	} else {
+		pw.header = Header{Version: FormatVersion, Mode: o.Mode, KDF: o.KDF, Salt: salt, ID: id}
+		pw.key, err = Option{Key: o.Key, Pipeline: o.Pipeline}.deriveKey(o.KDF, salt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	head, err := encodeHeader(pw.header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(head); err != nil {
+		return nil, err
+	}
+	pw.head = head
+	pw.offset = len(head)
+	pw.dataStart = len(head)
+	return pw, nil
+}
+
+// Add encrypts data and writes it to the container under name.
+//
+// name must be unique in the container.
+// Returns the table values of the new entry.
+func (w *Writer) Add(name string, data []byte) (Values, error) {
+	if w.closed {
+		return Values{}, errors.New("writer is closed")
+	}
+	if _, found := w.table[name]; found {
+		return Values{}, errors.New("duplicate file name: " + name)
+	}
+
+	ad := AssociatedData(w.header.Version, w.header.ID, name)
+	v, encData, err := sealEntry(EntryKey(w.key, w.header.ID, name), w.header.Mode, w.chunkSize, w.compression, name, data, ad)
+	if err != nil {
+		return Values{}, err
+	}
+	if _, err := w.w.Write(encData); err != nil {
+		return Values{}, err
+	}
+
+	v.StartPos = w.offset
+	v.EndPos = w.offset + len(encData)
+	w.offset = v.EndPos
+	w.table[name] = v
+	return v, nil
+}
+
+// sealEntry compresses and encrypts data with a new random nonce.
+// It returns the table values of the entry without the positions, and the encrypted data.
+//
+// chunkSize is only used for the authenticated modes. 0 means one block.
+// ad is the associated data of the entry (see AssociatedData), only used for the authenticated modes.
+func sealEntry(key []byte, mode MODE, chunkSize int, c COMPRESSION, name string, data, ad []byte) (Values, []byte, error) {
+	var nonce []byte
+	if size := NonceSize(mode); size > 0 {
+		nonce = make([]byte, size)
+		if _, err := rand.Read(nonce); err != nil {
+			return Values{}, nil, err
+		}
+	}
+
+	stored, compression, err := Compress(name, data, c)
+	if err != nil {
+		return Values{}, nil, err
+	}
+	compressedLen := 0
+	if compression != COMPRESSNONE {
+		compressedLen = len(stored)
+	}
+
+	if !isAEAD(mode) {
+		ad = nil
+	}
+	var encData []byte
+	if isAEAD(mode) && chunkSize > 0 {
+		encData, err = sealChunks(key, nonce, stored, ad, mode, chunkSize)
+	} else {
+		chunkSize = 0
+		encData, err = EncryptWithAD(key, nonce, stored, ad, mode)
+	}
+	if err != nil {
+		return Values{}, nil, err
+	}
+
+	originalHash := sha256.Sum256(data)
+	encryptedHash := sha256.Sum256(encData)
+	v := Values{
+		OriginalLenght: len(data),
+		EncryptLenght:  len(encData),
+		HashOriginal:   originalHash[:],
+		HashEncrypt:    encryptedHash[:],
+		Nonce:          nonce,
+		ChunkSize:      chunkSize,
+
+		Compression:      compression,
+		CompressedLenght: compressedLen,
+		AAD:              ad != nil,
+	}
+	return v, encData, nil
+}
+
+// Close writes the encrypted index and the footer.
+// The manifest is signed if WriterOption.SigningKey is set.
+// It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	idx := index{Entries: w.table}
+	if w.signingKey != nil {
+		m, err := containerManifest(w.header, w.table, int64(w.dataStart))
+		if err != nil {
+			return err
+		}
+		idx.Signature, err = signManifest(w.signingKey, m)
+		if err != nil {
+			return err
+		}
+		idx.Signer = ed25519.PrivateKey(w.signingKey).Public().(ed25519.PublicKey)
+	}
+	tail, err := sealIndex(w.key, w.head, idx, int64(w.offset))
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(tail)
+	w.key = nil
+	return err
+}
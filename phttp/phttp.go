@@ -0,0 +1,142 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+// Package phttp serves the decrypted entries of a paket over HTTP.
+//
+// The URL path is the name of the entry: "/ui/index.html" serves the entry "ui/index.html".
+// Mount it under a prefix with http.StripPrefix:
+//
+//	p, err := pengine.New(pengine.Option{Key: key, PaketFile: "web.pack"})
+//	http.Handle("/launcher/", http.StripPrefix("/launcher", phttp.NewHandler(p, phttp.Option{})))
+//
+// Range requests, If-None-Match, If-Range and HEAD are handled by http.ServeContent.
+// The entries are decrypted while they are written (see pengine.File). In the stream modes and for the chunked entries
+// of the authenticated modes, a range only decrypts its own part of the entry (see pengine.Paket.GetRange).
+package phttp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/SeanTolstoyevski/paket/pengine"
+)
+
+// Option keeps the settings of a Handler. The zero value is ready to use.
+type Option struct {
+	// entry served for the paths that end with a slash, in the same directory.
+	// Default is "index.html".
+	Index string
+
+	// Content-Type of the entries by file extension, like ".wasm": "application/wasm".
+	// It is checked before the types of the system (mime.TypeByExtension).
+	// The paket does not keep a content type for the entries,
+	// so the entries without a known extension get the type found from their first bytes (http.DetectContentType).
+	ContentTypes map[string]string
+
+	// decrypt the whole entry and check the hash of the original file before it is served (see pengine.Paket.GetFile).
+	// The authenticated modes check every chunk while reading. This option is for the other modes, which do not check anything.
+	// A Range request decrypts the whole entry too with this option.
+	VerifyHash bool
+}
+
+// Handler is an http.Handler that serves the entries of a paket. It should be created with NewHandler.
+//
+// The responses have an ETag from the hash of the original file (pengine.Values.HashOriginal),
+// so the browsers can ask again with If-None-Match and get 304 Not Modified without the data.
+// Missing entries are 404 Not Found. Only GET and HEAD are allowed.
+//
+// Handler can be used from many goroutines at the same time, like the Paket.
+type Handler struct {
+	p *pengine.Paket
+	o Option
+}
+
+// NewHandler creates a Handler that serves the entries of p.
+// p must not be closed while the handler is used.
+func NewHandler(p *pengine.Paket, o Option) *Handler {
+	if o.Index == "" {
+		o.Index = "index.html"
+	}
+	return &Handler{p: p, o: o}
+}
+
+// ServeHTTP writes the entry of the URL path.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := h.entryName(r.URL.Path)
+	f, err := h.p.OpenFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	v, _ := info.Sys().(pengine.Values)
+	if len(v.HashOriginal) > 0 {
+		w.Header().Set("ETag", `"`+hex.EncodeToString(v.HashOriginal)+`"`)
+	}
+	// without it, ServeContent finds the type from the extension or the first bytes.
+	if ct, found := h.o.ContentTypes[strings.ToLower(path.Ext(name))]; found {
+		w.Header().Set("Content-Type", ct)
+	}
+
+	var content io.ReadSeeker = f
+	if h.o.VerifyHash && !notModified(r, w.Header().Get("ETag")) {
+		data, ok, err := h.p.GetFile(name, true, true)
+		if err != nil || !ok {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+
+	// the entries have no modification time, the zero time is not written.
+	http.ServeContent(w, r, name, time.Time{}, content)
+}
+
+// entryName returns the entry name of a URL path. The Index is added to the directory paths.
+func (h *Handler) entryName(urlPath string) string {
+	name := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if name == "" || strings.HasSuffix(urlPath, "/") {
+		name = path.Join(name, h.o.Index)
+	}
+	return name
+}
+
+// notModified reports whether the If-None-Match header of the request has the ETag.
+// It is only used to skip the hash check, the response is written by ServeContent.
+func notModified(r *http.Request, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,210 @@
+// Copyright (C) 2021 SeanTolstoyevski -  mailto:seantolstoyevski@protonmail.com
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package phttp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SeanTolstoyevski/paket/pengine"
+)
+
+var testFiles = map[string][]byte{
+	"index.html":      []byte("<h1>paket</h1>"),
+	"ui/index.html":   bytes.Repeat([]byte("<p>launcher</p>\n"), 1000),
+	"ui/app.wasm":     []byte("\x00asm\x01\x00\x00\x00"),
+	"ui/data/big.bin": bytes.Repeat([]byte("0123456789"), 10000),
+}
+
+// newTestHandler writes testFiles to a new paket and returns a Handler for it.
+func newTestHandler(t *testing.T, mode pengine.MODE, o Option) *Handler {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "web.pack")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := pengine.NewWriter(f, pengine.WriterOption{Key: []byte("test key"), Mode: mode, ChunkSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range testFiles {
+		if _, err := w.Add(name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := pengine.New(pengine.Option{Key: []byte("test key"), PaketFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return NewHandler(p, o)
+}
+
+// serve sends a request to h and returns the response.
+func serve(h http.Handler, method, target string, header map[string]string) *http.Response {
+	r := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Result()
+}
+
+func body(t *testing.T, res *http.Response) []byte {
+	t.Helper()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestServe(t *testing.T) {
+	for _, mode := range []pengine.MODE{pengine.MODEGCM, pengine.MODECTR, pengine.MODECBC} {
+		for _, verify := range []bool{false, true} {
+			h := newTestHandler(t, mode, Option{VerifyHash: verify, ContentTypes: map[string]string{".wasm": "application/wasm"}})
+			for name, want := range testFiles {
+				res := serve(h, http.MethodGet, "/"+name, nil)
+				if res.StatusCode != http.StatusOK {
+					t.Fatalf("mode %d, %s: status %d", mode, name, res.StatusCode)
+				}
+				if got := body(t, res); !bytes.Equal(got, want) {
+					t.Fatalf("mode %d, %s: wrong content", mode, name)
+				}
+				if res.Header.Get("ETag") == "" {
+					t.Fatalf("mode %d, %s: no ETag", mode, name)
+				}
+			}
+		}
+	}
+
+	h := newTestHandler(t, pengine.MODEGCM, Option{ContentTypes: map[string]string{".wasm": "application/wasm"}})
+	if ct := serve(h, http.MethodGet, "/ui/app.wasm", nil).Header.Get("Content-Type"); ct != "application/wasm" {
+		t.Errorf("Content-Type of app.wasm: %q", ct)
+	}
+	if ct := serve(h, http.MethodGet, "/ui/index.html", nil).Header.Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type of index.html: %q", ct)
+	}
+}
+
+func TestServeRange(t *testing.T) {
+	want := testFiles["ui/data/big.bin"]
+	for _, mode := range []pengine.MODE{pengine.MODEGCM, pengine.MODECTR, pengine.MODECBC} {
+		for _, verify := range []bool{false, true} {
+			h := newTestHandler(t, mode, Option{VerifyHash: verify})
+			res := serve(h, http.MethodGet, "/ui/data/big.bin", map[string]string{"Range": "bytes=5000-14999"})
+			if res.StatusCode != http.StatusPartialContent {
+				t.Fatalf("mode %d: status %d, want 206", mode, res.StatusCode)
+			}
+			if cr := res.Header.Get("Content-Range"); cr != "bytes 5000-14999/100000" {
+				t.Fatalf("mode %d: Content-Range %q", mode, cr)
+			}
+			if got := body(t, res); !bytes.Equal(got, want[5000:15000]) {
+				t.Fatalf("mode %d: wrong content of the range", mode)
+			}
+
+			res = serve(h, http.MethodGet, "/ui/data/big.bin", map[string]string{"Range": "bytes=-10"})
+			if got := body(t, res); res.StatusCode != http.StatusPartialContent || !bytes.Equal(got, want[len(want)-10:]) {
+				t.Fatalf("mode %d: suffix range: status %d", mode, res.StatusCode)
+			}
+
+			res = serve(h, http.MethodGet, "/ui/data/big.bin", map[string]string{"Range": "bytes=200000-"})
+			if res.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+				t.Fatalf("mode %d: range after the end: status %d, want 416", mode, res.StatusCode)
+			}
+		}
+	}
+}
+
+func TestServeNotModified(t *testing.T) {
+	for _, verify := range []bool{false, true} {
+		h := newTestHandler(t, pengine.MODEGCM, Option{VerifyHash: verify})
+		etag := serve(h, http.MethodGet, "/ui/index.html", nil).Header.Get("ETag")
+
+		res := serve(h, http.MethodGet, "/ui/index.html", map[string]string{"If-None-Match": etag})
+		if res.StatusCode != http.StatusNotModified {
+			t.Fatalf("status %d, want 304", res.StatusCode)
+		}
+		if len(body(t, res)) != 0 {
+			t.Fatal("304 response has a body")
+		}
+		res = serve(h, http.MethodGet, "/ui/index.html", map[string]string{"If-None-Match": `W/"other", ` + etag})
+		if res.StatusCode != http.StatusNotModified {
+			t.Fatalf("list of ETags: status %d, want 304", res.StatusCode)
+		}
+		res = serve(h, http.MethodGet, "/ui/index.html", map[string]string{"If-None-Match": `"other"`})
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("other ETag: status %d, want 200", res.StatusCode)
+		}
+	}
+}
+
+func TestServeNotFound(t *testing.T) {
+	h := newTestHandler(t, pengine.MODEGCM, Option{})
+	for _, target := range []string{"/missing.html", "/ui/missing.js", "/ui/data/", "/../../etc/passwd"} {
+		if res := serve(h, http.MethodGet, target, nil); res.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: status %d, want 404", target, res.StatusCode)
+		}
+	}
+}
+
+func TestServeDirectory(t *testing.T) {
+	h := newTestHandler(t, pengine.MODEGCM, Option{})
+	paths := map[string]string{
+		"/":    "index.html",
+		"/ui/": "ui/index.html",
+		"":     "index.html",
+	}
+	for target, name := range paths {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.URL.Path = target
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		res := w.Result()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%q: status %d", target, res.StatusCode)
+		}
+		if got := body(t, res); !bytes.Equal(got, testFiles[name]) {
+			t.Fatalf("%q: not the content of %s", target, name)
+		}
+	}
+
+	// a directory path without the slash is not an entry.
+	if res := serve(h, http.MethodGet, "/ui", nil); res.StatusCode != http.StatusNotFound {
+		t.Errorf("/ui: status %d, want 404", res.StatusCode)
+	}
+
+	h = newTestHandler(t, pengine.MODEGCM, Option{Index: "app.wasm"})
+	if got := body(t, serve(h, http.MethodGet, "/ui/", nil)); !bytes.Equal(got, testFiles["ui/app.wasm"]) {
+		t.Error("Option.Index is not used")
+	}
+}
+
+func TestServeMethod(t *testing.T) {
+	h := newTestHandler(t, pengine.MODEGCM, Option{})
+	res := serve(h, http.MethodPost, "/index.html", nil)
+	if res.StatusCode != http.StatusMethodNotAllowed || res.Header.Get("Allow") != "GET, HEAD" {
+		t.Errorf("POST: status %d, Allow %q", res.StatusCode, res.Header.Get("Allow"))
+	}
+	res = serve(h, http.MethodHead, "/index.html", nil)
+	if res.StatusCode != http.StatusOK || len(body(t, res)) != 0 {
+		t.Errorf("HEAD: status %d", res.StatusCode)
+	}
+}
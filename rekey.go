@@ -0,0 +1,166 @@
+// Copyright (C) 2021 SeanTolstoyevski - mailto:seantolstoyevski@protonmail.com
+//
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	paket "github.com/SeanTolstoyevski/paket/pengine"
+)
+
+// runRekey encrypts a paket again with a new key and KDF.
+//
+//	paket rekey -p data.pack -k old_key -newkey new_key -newkdf argon2id
+//
+// With -rewrap, only the key slot opened by -k is changed, the files are not encrypted again.
+func runRekey(args []string) {
+	flagSet := flag.NewFlagSet("rekey", flag.ExitOnError)
+	of := addOpenFlags(flagSet)
+	newKey := flagSet.String("newkey", "", "The new key. It can only be empty if the new paket has recipients.")
+	newKDF := flagSet.String("newkdf", "pbkdf2", "The new key derivation function, like -kdf of the tool: ''pbkdf2'', ''scrypt:n=32768,r=8,p=1'' or ''argon2id''.\nFor ''pbkdf2'' without parameters, -newi is used.")
+	newIter := flagSet.Uint("newi", 4096, "The new PBKDF2 iteration.")
+	newTemplate := flagSet.String("newitertemplate", "", "JSON template of a new key derivation pipeline. If it is set, -newkdf and -newi are not used.")
+	newMode := flagSet.String("newmode", "", "The new encryption mode. By default the mode is not changed.")
+	output := flagSet.String("o", "", "The new paket file. By default the paket is replaced when everything is encrypted.")
+	newTable := flagSet.String("newtable", "", "The new Go table of a legacy paket. By default the table (-t) is replaced.\nIt is needed with -o, the old paket still needs the old table.")
+	rewrap := flagSet.Bool("rewrap", false, "only change the key slot opened by -k, for a paket created with -envelope.\nThe files are not encrypted again. -newitertemplate and -newmode are not used.")
+	envelope := flagSet.String("envelope", "", "''true'' or ''false'': write the new paket with key slots (see -envelope of the tool).\nBy default a paket with key slots keeps them. The password slots are replaced by -newkey, the recipients are kept.")
+	var newRecipients recipientFlags
+	flagSet.Var(&newRecipients, "newrecipient", "X25519 public key of a new recipient, like -r of the tool. Can be given more than once.")
+	flagSet.Parse(args)
+
+	recipients, err := newRecipients.recipients()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	n := paket.WriterOption{Recipients: recipients}
+	if *newKey != "" || len(recipients) == 0 {
+		n.Key, n.KDF, err = parseNewKey(*newKey, *newKDF, *newIter)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+	if *newTemplate != "" {
+		n.Pipeline, err = paket.LoadKeyDerivationPipeline(*newTemplate)
+		if err != nil {
+			fmt.Println("Error: loading the iteration template:", err)
+			os.Exit(1)
+		}
+	}
+	if *newMode != "" {
+		n.Mode, err = parseMode(*newMode)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+
+	opt, err := of.option()
+	if err != nil {
+		fmt.Println("Error: opening the paket:", err)
+		os.Exit(1)
+	}
+	dst := *output
+	if dst == "" {
+		dst = opt.PaketFile
+	}
+	if opt.Table != nil && *output != "" && *newTable == "" {
+		fmt.Println("-newtable is needed with -o: the old paket still needs its table (-t).")
+		os.Exit(2)
+	}
+
+	if *rewrap {
+		if err := paket.RewrapKeySlot(opt, n.Key, n.KDF, dst); err != nil {
+			fmt.Println("Error: rewrapping the key slot:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("the key slot of %s is changed.\n", dst)
+		return
+	}
+	slots, slotsErr := paket.KeySlots(opt.PaketFile)
+	if *envelope == "" {
+		n.Envelope = slotsErr == nil
+	} else {
+		n.Envelope, err = strconv.ParseBool(*envelope)
+		if err != nil {
+			fmt.Println("-envelope must be ''true'' or ''false''.")
+			os.Exit(2)
+		}
+	}
+	// the recipients only need their public keys, which are in the header. They are kept.
+	if n.Envelope && slotsErr == nil {
+		for _, slot := range slots {
+			if slot.Recipient != nil {
+				n.Recipients = append(n.Recipients, paket.Recipient{Name: slot.Name, PublicKey: slot.Recipient})
+			}
+		}
+	}
+
+	if opt.Table != nil {
+		tablePath := *newTable
+		if tablePath == "" {
+			tablePath = *of.table
+		}
+		if err := rekeyLegacy(opt, n, dst, tablePath); err != nil {
+			fmt.Println("Error: rekeying the paket:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s and %s are encrypted with the new key.\n", dst, tablePath)
+		return
+	}
+	if _, err := paket.Rekey(opt, n, dst); err != nil {
+		fmt.Println("Error: rekeying the paket:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s is encrypted with the new key.\n", dst)
+}
+
+// rekeyLegacy rekeys a legacy paket to dst and writes its new Go table to tablePath.
+// The paket and the table are changed together: both are written to temporary files first,
+// and renamed only when both are written. If the paket cannot be renamed, the old table is written back.
+func rekeyLegacy(opt paket.Option, n paket.WriterOption, dst, tablePath string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	tmpPack := tmp.Name()
+	rekeyed, err := paket.Rekey(opt, n, tmpPack)
+	if err != nil {
+		os.Remove(tmpPack)
+		return err
+	}
+	tmpTable, err := writeGoTableTemp(tablePath, rekeyed)
+	if err != nil {
+		os.Remove(tmpPack)
+		return err
+	}
+
+	oldTable, oldErr := ioutil.ReadFile(tablePath)
+	if err := os.Rename(tmpTable, tablePath); err != nil {
+		os.Remove(tmpTable)
+		os.Remove(tmpPack)
+		return err
+	}
+	if err := os.Rename(tmpPack, dst); err != nil {
+		os.Remove(tmpPack)
+		if oldErr == nil {
+			if werr := ioutil.WriteFile(tablePath, oldTable, 0644); werr != nil {
+				return fmt.Errorf("%v, and the old table cannot be written back: %v", err, werr)
+			}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright (C) 2021 SeanTolstoyevski - mailto:seantolstoyevski@protonmail.com
+//
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	paket "github.com/SeanTolstoyevski/paket/pengine"
+)
+
+// readTestFiles returns the content of the files.
+func readTestFiles(t *testing.T, paths ...string) [][]byte {
+	t.Helper()
+	out := make([][]byte, len(paths))
+	for i, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[i] = data
+	}
+	return out
+}
+
+// checkNoTempFiles fails if a temporary file is left in dir.
+func checkNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(matches) != 0 {
+		t.Errorf("temporary files are left: %v", matches)
+	}
+}
+
+func TestRekeyLegacy(t *testing.T) {
+	o := writeLegacyTestPaket(t, map[string]string{"a.txt": "alpha", "b.txt": "bravo", "c.txt": "charlie"})
+	dir := filepath.Dir(o.PaketFile)
+	tablePath := filepath.Join(dir, "table.go")
+	if err := writeGoTable(tablePath, o); err != nil {
+		t.Fatal(err)
+	}
+	before := readTestFiles(t, o.PaketFile, tablePath)
+
+	if err := rekeyLegacy(o, paket.WriterOption{Key: []byte("new key"), Mode: paket.MODEGCM}, o.PaketFile, tablePath); err != nil {
+		t.Fatal(err)
+	}
+	after := readTestFiles(t, o.PaketFile, tablePath)
+	if bytes.Equal(before[0], after[0]) || bytes.Equal(before[1], after[1]) {
+		t.Error("the paket or the table is not replaced")
+	}
+	checkNoTempFiles(t, dir)
+
+	p, err := paket.New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if _, ok, err := p.GetFile("a.txt", true, true); err == nil && ok {
+		t.Error("the entry is still read with the old key and table")
+	}
+}
+
+// the paket and the table are both kept when the rekey fails.
+func TestRekeyLegacyError(t *testing.T) {
+	o := writeLegacyTestPaket(t, map[string]string{"a.txt": "alpha", "b.txt": "bravo", "c.txt": "charlie"})
+	dir := filepath.Dir(o.PaketFile)
+	tablePath := filepath.Join(dir, "table.go")
+	if err := writeGoTable(tablePath, o); err != nil {
+		t.Fatal(err)
+	}
+	before := readTestFiles(t, o.PaketFile, tablePath)
+
+	v := o.Table["b.txt"]
+	v.HashOriginal = o.Table["a.txt"].HashOriginal
+	o.Table["b.txt"] = v
+	if err := rekeyLegacy(o, paket.WriterOption{Key: []byte("new key")}, o.PaketFile, tablePath); !errors.Is(err, paket.ErrHashMismatch) {
+		t.Fatalf("rekeyLegacy: %v, want ErrHashMismatch", err)
+	}
+	after := readTestFiles(t, o.PaketFile, tablePath)
+	if !bytes.Equal(before[0], after[0]) || !bytes.Equal(before[1], after[1]) {
+		t.Error("the paket or the table is changed by a failed rekey")
+	}
+	checkNoTempFiles(t, dir)
+}
@@ -0,0 +1,55 @@
+// Copyright (C) 2021 SeanTolstoyevski - mailto:seantolstoyevski@protonmail.com
+//
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	paket "github.com/SeanTolstoyevski/paket/pengine"
+)
+
+// runSign signs the manifest of a paket. For a legacy paket, the signature is written to the Go table.
+//
+//	paket sign -p data.pack -k my_secret_key -signkey build.key
+func runSign(args []string) {
+	flagSet := flag.NewFlagSet("sign", flag.ExitOnError)
+	of := addOpenFlags(flagSet)
+	signKey := flagSet.String("signkey", "", "Ed25519 private key (a .key file of ''keygen -type ed25519'', or hex).")
+	flagSet.Parse(args)
+
+	if *signKey == "" {
+		fmt.Println("-signkey cannot be empty.")
+		os.Exit(2)
+	}
+	privateKey, err := readHexKey(*signKey)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	opt, err := of.option()
+	if err != nil {
+		fmt.Println("Error: opening the paket:", err)
+		os.Exit(1)
+	}
+
+	opt.Signature, err = paket.Sign(opt, privateKey)
+	if err != nil {
+		fmt.Println("Error: signing the paket:", err)
+		os.Exit(1)
+	}
+	if opt.Table != nil {
+		if err := writeGoTable(*of.table, opt); err != nil {
+			fmt.Println("Error: writing the table:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s is signed, the signature is written to %s.\n", opt.PaketFile, *of.table)
+		return
+	}
+	fmt.Printf("%s is signed.\n", opt.PaketFile)
+}
@@ -0,0 +1,129 @@
+// Copyright (C) 2021 SeanTolstoyevski - mailto:seantolstoyevski@protonmail.com
+//
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	paket "github.com/SeanTolstoyevski/paket/pengine"
+)
+
+// runSlot lists, adds or removes the key slots of a paket created with -envelope.
+//
+//	paket slot list -p data.pack
+//	paket slot add -p data.pack -k my_secret_key -name ci -newkey ci_key -newkdf argon2id
+//	paket slot add -p data.pack -k my_secret_key -recipient client.pub
+//	paket slot rm -p data.pack -k my_secret_key -name ci
+func runSlot(args []string) {
+	usage := func() {
+		fmt.Printf("Usage: %s slot list|add|rm [flags]\n", os.Args[0])
+	}
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	flagSet := flag.NewFlagSet("slot "+args[0], flag.ExitOnError)
+	of := addOpenFlags(flagSet)
+	name := flagSet.String("name", "", "Name of the key slot.")
+	newKey := flagSet.String("newkey", "", "Key of the new slot. For the ''raw'' KDF it is a hex encoded 32 byte key.")
+	newKDF := flagSet.String("newkdf", "pbkdf2", "Key derivation function of the new slot, like -kdf of the tool: ''pbkdf2'', ''scrypt'', ''argon2id'' or ''raw''.\nFor ''pbkdf2'' without parameters, -newi is used.")
+	newIter := flagSet.Uint("newi", 4096, "PBKDF2 iteration of the new slot.")
+	recipient := flagSet.String("recipient", "", "X25519 public key (a .pub file of keygen, or hex) of the new slot, instead of -newkey.\nBy default the slot is named with the fingerprint of the key.")
+	flagSet.Parse(args[1:])
+
+	switch args[0] {
+	case "list":
+		slots, err := paket.KeySlots(*of.pack)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tKDF\tRECIPIENT")
+		for _, slot := range slots {
+			recipient := "-"
+			if slot.Recipient != nil {
+				recipient = paket.X25519Fingerprint(slot.Recipient)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", slot.Name, slot.KDF, recipient)
+		}
+		tw.Flush()
+		return
+	case "add", "rm":
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if *name == "" && (args[0] == "rm" || *recipient == "") {
+		fmt.Println("-name cannot be empty.")
+		os.Exit(2)
+	}
+	opt, err := of.option()
+	if err != nil {
+		fmt.Println("Error: opening the paket:", err)
+		os.Exit(1)
+	}
+
+	if args[0] == "add" && *recipient != "" {
+		public, err := readHexKey(*recipient)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		if err := paket.AddRecipient(opt, paket.Recipient{Name: *name, PublicKey: public}); err != nil {
+			fmt.Println("Error: adding the key slot:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("recipient %s is added to %s.\n", paket.X25519Fingerprint(public), opt.PaketFile)
+		return
+	}
+	if args[0] == "rm" {
+		if err := paket.RemoveKeySlot(opt, *name); err != nil {
+			fmt.Println("Error: removing the key slot:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("key slot %s is removed from %s.\n", *name, opt.PaketFile)
+		return
+	}
+
+	key, kdf, err := parseNewKey(*newKey, *newKDF, *newIter)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	if err := paket.AddKeySlot(opt, *name, key, kdf); err != nil {
+		fmt.Println("Error: adding the key slot:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("key slot %s is added to %s.\n", *name, opt.PaketFile)
+}
+
+// parseNewKey returns the key and the KDF for the -newkey, -newkdf and -newi flags.
+// The key of the "raw" KDF is hex encoded.
+func parseNewKey(key, kdfName string, iteration uint) ([]byte, paket.KDF, error) {
+	if key == "" {
+		return nil, paket.KDF{}, fmt.Errorf("-newkey cannot be empty")
+	}
+	kdf, err := paket.ParseKDF(kdfName)
+	if err != nil {
+		return nil, paket.KDF{}, err
+	}
+	if strings.ToLower(kdfName) == "pbkdf2" {
+		kdf.Iteration = iteration
+	}
+	newKey, err := parseKey(key, kdf.Algorithm == paket.KDFRAW)
+	if err != nil {
+		return nil, paket.KDF{}, err
+	}
+	return newKey, kdf, nil
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2021 SeanTolstoyevski - mailto:seantolstoyevski@protonmail.com
+//
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// packFile is a file found in the folder to be packed.
+type packFile struct {
+	// path of the file on disk.
+	path string
+
+	// slash-separated path relative to the folder.
+	// This is the name written to the table. For example "textures/ui/button.png".
+	name string
+
+	size int64
+}
+
+// collectFiles walks the folder recursively and returns the regular files in it.
+//
+// Symbolic links are skipped unless followLinks is true. A linked folder is walked once, so loops are not a problem.
+// Hidden files and folders (names starting with a dot) are skipped unless hidden is true.
+func collectFiles(root string, followLinks, hidden bool) ([]packFile, error) {
+	var files []packFile
+	visited := make(map[string]bool)
+
+	var walk func(dir, rel string) error
+	walk = func(dir, rel string) error {
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return err
+		}
+		if visited[real] {
+			return nil
+		}
+		visited[real] = true
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !hidden && strings.HasPrefix(name, ".") {
+				continue
+			}
+			full := filepath.Join(dir, name)
+			relName := path.Join(rel, name)
+
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			if info.Mode()&os.ModeSymlink != 0 {
+				if !followLinks {
+					continue
+				}
+				if info, err = os.Stat(full); err != nil {
+					return err
+				}
+			}
+
+			switch {
+			case info.IsDir():
+				if err := walk(full, relName); err != nil {
+					return err
+				}
+			case info.Mode().IsRegular():
+				files = append(files, packFile{path: full, name: relName, size: info.Size()})
+			}
+		}
+		return nil
+	}
+
+	return files, walk(root, "")
+}
@@ -0,0 +1,106 @@
+// Copyright (C) 2021 SeanTolstoyevski - mailto:seantolstoyevski@protonmail.com
+//
+// The source code of this project is licensed under the MIT license.
+// You can find the license on the repo's main folder.
+// Provided without warranty of any kind.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// writeTestTree creates the files in dir. The names are slash-separated.
+func writeTestTree(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, name := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// collectTestNames returns the sorted names found by collectFiles.
+func collectTestNames(t *testing.T, root string, followLinks, hidden bool) []string {
+	t.Helper()
+	files, err := collectFiles(root, followLinks, hidden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.name
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestCollectFiles(t *testing.T) {
+	root := t.TempDir()
+	writeTestTree(t, root, "readme.txt", "textures/ui/button.png", "textures/sky.png", ".git/config", "sounds/.hidden.wav", "sounds/click.wav")
+	if err := os.MkdirAll(filepath.Join(root, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"readme.txt", "sounds/click.wav", "textures/sky.png", "textures/ui/button.png"}
+	if got := collectTestNames(t, root, false, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("names: %v, want %v", got, want)
+	}
+	want = []string{".git/config", "readme.txt", "sounds/.hidden.wav", "sounds/click.wav", "textures/sky.png", "textures/ui/button.png"}
+	if got := collectTestNames(t, root, false, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("names with hidden files: %v, want %v", got, want)
+	}
+
+	files, err := collectFiles(root, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if want := filepath.Join(root, filepath.FromSlash(f.name)); f.path != want {
+			t.Errorf("%s: path %q, want %q", f.name, f.path, want)
+		}
+		// writeTestTree writes the name as the content.
+		if f.size != int64(len(f.name)) {
+			t.Errorf("%s: size %d", f.name, f.size)
+		}
+	}
+
+	if _, err := collectFiles(filepath.Join(root, "missing"), false, false); err == nil {
+		t.Error("missing folder is accepted")
+	}
+}
+
+func TestCollectFilesLinks(t *testing.T) {
+	root := t.TempDir()
+	writeTestTree(t, root, "data/a.txt", "readme.txt")
+	outside := t.TempDir()
+	writeTestTree(t, outside, "other.txt")
+	links := map[string]string{
+		"link.txt":  filepath.Join(root, "readme.txt"),
+		"outside":   outside,
+		"data/loop": root,
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Skip("symbolic links are not supported:", err)
+		}
+	}
+
+	want := []string{"data/a.txt", "readme.txt"}
+	if got := collectTestNames(t, root, false, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("names without links: %v, want %v", got, want)
+	}
+	// the loop back to root is walked once.
+	want = []string{"data/a.txt", "link.txt", "outside/other.txt", "readme.txt"}
+	if got := collectTestNames(t, root, true, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("names with links: %v, want %v", got, want)
+	}
+}